@@ -15,8 +15,10 @@ require (
 	github.com/metaslink/metasdns v0.0.0-20211230190103-80ba25a91d75
 	github.com/miekg/dns v1.1.43
 	github.com/orcaman/concurrent-map v1.0.0
+	github.com/oschwald/maxminddb-golang v1.8.0
 	github.com/qiangxue/fasthttp-routing v0.0.0-20160225050629-6ccdc2a18d87
 	github.com/robfig/cron/v3 v3.0.1
 	github.com/valyala/fasthttp v1.31.0
+	golang.org/x/net v0.0.0-20211201190559-0a0e4e1bb54c
 	google.golang.org/protobuf v1.27.1
 )
@@ -0,0 +1,130 @@
+package datahub
+
+import (
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/test"
+)
+
+const testAbpList = `[Adblock Plus 2.0]
+! Title: test list
+||doubleclick.net^
+|http://ads.example.com^
+||ad*.tracker.io^
+/^banner[0-9]+\./
+||tracker.io^$important
+@@||good.doubleclick.net^
+||block.example.info^$important
+@@||example.info^
+@@||ok.example.info^$important
+||script.example.org^$script
+example.com##.ad-banner
+||example.org/ads/*
+native.example.net
+||例子.测试^
+`
+
+func loadTestDomainTable(t *testing.T, dh *Datahub, tag string, format string, content string) {
+	fname, rm, err := test.TempFile(t.TempDir(), content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(rm)
+	dh.parseGroupDomainTableByTag("", []string{tag}, fname, format)
+}
+
+func TestDatahub_AbpDomainTable(t *testing.T) {
+	for _, format := range []string{"auto", "abp"} {
+		dh := NewDatahub()
+		loadTestDomainTable(t, dh, "ads", format, testAbpList)
+		cases := map[string]bool{
+			"doubleclick.net":         true,
+			"x.doubleclick.net":       true,
+			"good.doubleclick.net":    false,
+			"ads.example.com":         true,
+			"www.ads.example.com":     false,
+			"ad1.tracker.io":          true,
+			"x.adserver.tracker.io":   true,
+			"tracker.io":              true,
+			"banner12.example.com":    true,
+			"script.example.org":      false,
+			"native.example.net":      true,
+			"sub.native.example.net":  true,
+			"block.example.info":      true,
+			"x.block.example.info":    true,
+			"ok.example.info":         false,
+			"www.example.com":         false,
+			"adblockplus.example.org": false,
+			"www.例子.测试":               true,
+			"xn--fsqu00a.xn--0zwm56d": true,
+		}
+		for name, want := range cases {
+			if got := dh.MixMatch("ads", name); got != want {
+				t.Errorf("%s: MixMatch(%s) = %v, want %v", format, name, got, want)
+			}
+		}
+		if e := dh.Explain("ads", "block.example.info"); !e.Matched || e.Rule != "block.example.info" || e.Except != "" {
+			t.Errorf("%s: Explain important rule = %+v", format, e)
+		}
+		if e := dh.Explain("ads", "good.doubleclick.net"); e.Matched || e.Except != "good.doubleclick.net" {
+			t.Errorf("%s: Explain exception = %+v", format, e)
+		}
+		waitTagIndex(t, dh)
+		if tags := dh.TagsOf("block.example.info"); len(tags) != 1 || tags[0] != "ADS" {
+			t.Errorf("%s: TagsOf important rule = %v", format, tags)
+		}
+		u := dh.UnsupportedDomainRules("ads")
+		if u == nil || u.Count != 3 || len(u.Samples) != 3 {
+			t.Fatalf("%s: unsupported = %+v", format, u)
+		}
+	}
+}
+
+func TestDatahub_AbpAutoNative(t *testing.T) {
+	dh := NewDatahub()
+	loadTestDomainTable(t, dh, "ads", "auto", "ads full www.example.com\n@@ok.example.net\nexample.net\n||doubleclick.net^\n")
+	for name, want := range map[string]bool{
+		"www.example.com":     true,
+		"a.www.example.com":   false,
+		"x.example.net":       true,
+		"ok.example.net":      false,
+		"ads.doubleclick.net": true,
+	} {
+		if got := dh.MixMatch("ads", name); got != want {
+			t.Errorf("MixMatch(%s) = %v, want %v", name, got, want)
+		}
+	}
+	if u := dh.UnsupportedDomainRules("ads"); u == nil || u.Count != 0 {
+		t.Errorf("unsupported = %+v", u)
+	}
+	if dh.UnsupportedDomainRules("none") != nil {
+		t.Error("unsupported of unknown table should be nil")
+	}
+}
+
+func Test_parseConfigDomainFormat(t *testing.T) {
+	fname, rm, err := test.TempFile(t.TempDir(), "||doubleclick.net^\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+	c := caddy.NewTestController("dns", `datahub {
+        client_group office netlist:office
+        domain_table ads `+fname+` format abp group office
+    }`)
+	dh, err := parseConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dh.MixMatch("office/ads", "x.doubleclick.net") {
+		t.Error("abp domain_table in group should match")
+	}
+
+	c = caddy.NewTestController("dns", `datahub {
+        domain_table ads `+fname+` format easylist
+    }`)
+	if _, err := parseConfig(c); err == nil {
+		t.Fatal("expected error for unsupported domain_table format")
+	}
+}
@@ -0,0 +1,71 @@
+package datahub
+
+import (
+	"fmt"
+
+	"github.com/c-robinson/iplib"
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+)
+
+// LookupASN 返回地址所属的自治系统, 按标签顺序查询 ASN 表, 未找到时返回 nil
+func (dh *Datahub) LookupASN(ip string) *datatable.ASNInfo {
+	inet, err := netutils.ParseIpNet(ip)
+	if err != nil {
+		return nil
+	}
+	return dh.lookupASNNet(inet)
+}
+
+func (dh *Datahub) lookupASNNet(inet iplib.Net) *datatable.ASNInfo {
+	for _, tag := range sortedKeys(dh.asnTableMap.Keys()) {
+		if list := dh.getDataTableByTag(datatable.DateTypeAsnTable, tag); list != nil {
+			if info := list.GetData().(*datatable.AsnData).LookupNet(inet); info != nil {
+				return info
+			}
+		}
+	}
+	return nil
+}
+
+// MatchASN 判断地址是否属于自治系统, asn 为 AS13335 或 13335 形式
+func (dh *Datahub) MatchASN(asn string, ip string) bool {
+	n, ok := datatable.ParseASN(asn)
+	if !ok {
+		return false
+	}
+	if info := dh.LookupASN(ip); info != nil && info.ASN == n {
+		dh.networkMatchStat.Incr(fmt.Sprintf("AS%d", n), 1)
+		return true
+	}
+	return false
+}
+
+// matchNetlist 匹配网络地址表的网段及 AS 编号
+func (dh *Datahub) matchNetlist(data *datatable.NetlistData, inet iplib.Net) bool {
+	if data.MatchNet(inet) {
+		return true
+	}
+	_, ok := dh.matchNetlistASN(data, inet)
+	return ok
+}
+
+// matchNetlistASN 返回网络地址表中包含 inet 所属自治系统的 AS 编号
+func (dh *Datahub) matchNetlistASN(data *datatable.NetlistData, inet iplib.Net) (uint32, bool) {
+	if data.ASNLen() == 0 {
+		return 0, false
+	}
+	if info := dh.lookupASNNet(inet); info != nil && data.HasASN(info.ASN) {
+		return info.ASN, true
+	}
+	return 0, false
+}
+
+// invalidateNetlistASN ASN 表变更后使包含 AS 编号的网络地址表缓存失效
+func (dh *Datahub) invalidateNetlistASN() {
+	dh.netlistTableMap.IterCb(func(key string, v interface{}) {
+		if v.(*datatable.DataTable).GetData().(*datatable.NetlistData).ASNLen() > 0 {
+			dh.matchCache.invalidate(key)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package datahub
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+)
+
+func TestDatahub_LookupASN(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeAsnTable, "ip2asn",
+		"1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n"+
+			"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n"+
+			"16843008\t16843263\t13335\tUS\tCLOUDFLARENET\n"+ // 1.1.1.0-1.1.1.255
+			"2606:4700::\t2606:4700:ffff:ffff:ffff:ffff:ffff:ffff\t13335\tUS\tCLOUDFLARENET\n")
+	loadTestTable(t, dh, datatable.DateTypeAsnTable, "geolite",
+		"network,autonomous_system_number,autonomous_system_organization\n"+
+			"8.8.8.0/24,15169,\"Google, LLC\"\n")
+
+	cases := []struct {
+		ip   string
+		asn  uint32
+		name string
+	}{
+		{"1.0.0.1", 13335, "CLOUDFLARENET"},
+		{"1.1.1.1", 13335, "CLOUDFLARENET"},
+		{"2606:4700::1111", 13335, "CLOUDFLARENET"},
+		{"8.8.8.8", 15169, "Google, LLC"},
+		{"1.0.2.1", 0, ""},
+		{"9.9.9.9", 0, ""},
+	}
+	for _, c := range cases {
+		info := dh.LookupASN(c.ip)
+		if c.asn == 0 {
+			if info != nil {
+				t.Errorf("LookupASN(%s) = %+v, want nil", c.ip, info)
+			}
+			continue
+		}
+		if info == nil || info.ASN != c.asn || info.Name != c.name {
+			t.Errorf("LookupASN(%s) = %+v, want AS%d %s", c.ip, info, c.asn, c.name)
+		}
+	}
+	if !dh.MatchASN("AS13335", "1.1.1.1") || !dh.MatchASN("15169", "8.8.8.8") || dh.MatchASN("AS15169", "1.1.1.1") {
+		t.Error("MatchASN mismatch")
+	}
+}
+
+func TestDatahub_NetlistASN(t *testing.T) {
+	dh := NewDatahub()
+	fname := filepath.Join(t.TempDir(), "ip2asn.tsv")
+	if err := os.WriteFile(fname, []byte("1.1.1.0\t1.1.1.255\t13335\tUS\tCLOUDFLARENET\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dh.parseDataTableByTag(datatable.DateTypeAsnTable, []string{"ip2asn"}, fname)
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "cdn", "cdn AS13335\ncdn as15169\ncdn 192.0.2.0/24\n")
+
+	if !dh.MixMatchNetByStr("cdn", "1.1.1.1") || !dh.MatchNetByStr("cdn", "192.0.2.1") || dh.MixMatchNetByStr("cdn", "9.9.9.9") {
+		t.Error("netlist ASN match mismatch")
+	}
+	waitTagIndex(t, dh)
+	if tags := dh.TagsOfIP("1.1.1.1"); !reflect.DeepEqual(tags, []string{"CDN"}) {
+		t.Errorf("TagsOfIP(1.1.1.1) = %v", tags)
+	}
+	e := dh.ExplainNet("cdn", "1.1.1.1")
+	if !e.Matched || e.Rule != "AS13335" || e.RuleType != netutils.MatchAsnType {
+		t.Errorf("ExplainNet = %+v", e)
+	}
+
+	// ASN 表重新加载后网络地址表的缓存结果失效
+	if err := os.WriteFile(fname, []byte("1.1.1.0\t1.1.1.255\t15169\tUS\tGOOGLE\n1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(fname, future, future)
+	dh.cronUpdateAsnTableMap()
+	if !dh.MixMatchNetByStr("cdn", "1.0.0.1") {
+		t.Error("1.0.0.1 should match after asn reload")
+	}
+	if info := dh.LookupASN("1.1.1.1"); info == nil || info.ASN != 15169 {
+		t.Errorf("LookupASN after reload = %+v", info)
+	}
+}
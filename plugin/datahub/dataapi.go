@@ -22,26 +22,44 @@ func (dh *Datahub) LoadGeoSiteFromDAT(country string) (*v2data.GeoSite, error) {
 	return loader.LoadGeoSiteFromDAT(dh.geositePath, country)
 }
 
+// MatchGeoip 匹配 geoip 地址, 按地址族使用主机网段匹配, 标签不在生效时间窗口内时不匹配
 func (dh *Datahub) MatchGeoip(tag string, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
 	tag = strings.ToUpper(tag)
-	inet := iplib.NewNet(ip, 32)
+	if !dh.tagActive(tag) {
+		return false
+	}
+	inet := netutils.HostNet(ip)
 	if list := dh.getGeoNetListByTag(tag); list != nil {
 		if list.MatchNet(inet) {
 			dh.networkMatchStat.Incr(tag, 1)
 			return true
 		}
 	}
+	if dh.matchGeoipMmdb(tag, inet) {
+		dh.networkMatchStat.Incr(tag, 1)
+		return true
+	}
 	return false
 }
 
 func (dh *Datahub) MatchGeoNet(tag string, net iplib.Net) bool {
 	tag = strings.ToUpper(tag)
+	if !dh.tagActive(tag) {
+		return false
+	}
 	if list := dh.getGeoNetListByTag(tag); list != nil {
 		if list.MatchNet(net) {
 			dh.networkMatchStat.Incr(tag, 1)
 			return true
 		}
 	}
+	if dh.matchGeoipMmdb(tag, net) {
+		dh.networkMatchStat.Incr(tag, 1)
+		return true
+	}
 	return false
 }
 
@@ -54,30 +72,36 @@ func (dh *Datahub) MixMatchNetByStr(tag string, ns string) bool {
 	return dh.MixMatchNet(tag, inet)
 }
 
-// MixMatchNet 混合模式匹配网络地址
+// MixMatchNet 混合模式匹配网络地址, 标签不在生效时间窗口内时不匹配
 func (dh *Datahub) MixMatchNet(tag string, ns iplib.Net) bool {
 	tag = strings.ToUpper(tag)
-	_, err := dh.matchCache.Get(tag + ns.String())
-	if err == nil {
-		dh.networkMatchStat.Incr(tag, 1)
-		return true
-	}
-	// 匹配自定义网络地址列表
-	if list := dh.getDataTableByTag(datatable.DateTypeNetlistTable, tag); list != nil &&
-		list.GetData().(*datatable.NetlistData).MatchNet(ns) {
-		dh.networkMatchStat.Incr(tag, 1)
-		_ = dh.matchCache.Set(tag+ns.String(), []byte(NetworkMatcher))
-		return true
+	if !dh.mixMatchNet(tag, ns) {
+		return false
 	}
+	dh.networkMatchStat.Incr(tag, 1)
+	return true
+}
 
-	// 匹配Geodat网络地址列表
-	if list := dh.getGeoNetListByTag(tag); list != nil && list.MatchNet(ns) {
-		dh.networkMatchStat.Incr(tag, 1)
-		_ = dh.matchCache.Set(tag+ns.String(), []byte(NetworkMatcher))
-		return true
+// mixMatchNet 同 MixMatchNet, 不计入网络标签统计, tag 需为大写
+func (dh *Datahub) mixMatchNet(tag string, ns iplib.Net) bool {
+	if !dh.tagActive(tag) {
+		return false
 	}
-
-	return false
+	return dh.matchCache.lookup(tag, tag+ns.String(), func() string {
+		// 匹配自定义网络地址列表
+		if list := dh.getDataTableByTag(datatable.DateTypeNetlistTable, tag); list != nil &&
+			dh.matchNetlist(list.GetData().(*datatable.NetlistData), ns) {
+			return NetworkMatcher
+		}
+		// 匹配Geodat网络地址列表
+		if list := dh.getGeoNetListByTag(tag); list != nil && list.MatchNet(ns) {
+			return NetworkMatcher
+		}
+		if dh.matchGeoipMmdb(tag, ns) {
+			return NetworkMatcher
+		}
+		return ""
+	}) != ""
 }
 
 // MatchNetByStr 匹配自定义网络地址
@@ -89,27 +113,33 @@ func (dh *Datahub) MatchNetByStr(tag string, ns string) bool {
 	return dh.MatchNet(tag, inet)
 }
 
-// MatchNet 匹配自定义网络地址
+// MatchNet 匹配自定义网络地址, 只匹配网络地址表, 缓存键与 MixMatchNet 区分
 func (dh *Datahub) MatchNet(tag string, ns iplib.Net) bool {
 	tag = strings.ToUpper(tag)
-	_, err := dh.matchCache.Get(tag + ns.String())
-	if err == nil {
-		dh.networkMatchStat.Incr(tag, 1)
-		return true
+	if !dh.tagActive(tag) {
+		return false
 	}
-	// 匹配自定义网络地址列表
-	if list := dh.getDataTableByTag(datatable.DateTypeNetlistTable, tag); list != nil &&
-		list.GetData().(*datatable.NetlistData).MatchNet(ns) {
-		dh.networkMatchStat.Incr(tag, 1)
-		_ = dh.matchCache.Set(tag+ns.String(), []byte(NetworkMatcher))
-		return true
+	matcher := dh.matchCache.lookup(tag, datatable.DateTypeNetlistTable+":"+tag+ns.String(), func() string {
+		if list := dh.getDataTableByTag(datatable.DateTypeNetlistTable, tag); list != nil &&
+			dh.matchNetlist(list.GetData().(*datatable.NetlistData), ns) {
+			return NetworkMatcher
+		}
+		return ""
+	})
+	if matcher == "" {
+		return false
 	}
-	return false
+	dh.networkMatchStat.Incr(tag, 1)
+	return true
 }
 
 // MatchGeosite 匹配 Geosite 域名
 func (dh *Datahub) MatchGeosite(matchType, tag string, name string) bool {
 	tag = strings.ToUpper(tag)
+	if !dh.tagActive(tag) {
+		return false
+	}
+	name = netutils.NormalizeDomain(name)
 	if list := dh.getGeoDomainListByTag(tag); list != nil {
 		if list.Match(matchType, name) {
 			dh.domainMatchStat.Incr(tag, 1)
@@ -119,9 +149,12 @@ func (dh *Datahub) MatchGeosite(matchType, tag string, name string) bool {
 	return false
 }
 
-// MatchKeyword 域名关键词匹配
+// MatchKeyword 域名关键词匹配, 标签不在生效时间窗口内时不匹配
 func (dh *Datahub) MatchKeyword(tag string, name string) bool {
 	tag = strings.ToUpper(tag)
+	if !dh.tagActive(tag) {
+		return false
+	}
 	if list := dh.getDataTableByTag(datatable.DateTypeKeywordTable, tag); list != nil {
 		if list.Match(name) {
 			dh.keywordMatchStat.Incr(tag, 1)
@@ -131,6 +164,25 @@ func (dh *Datahub) MatchKeyword(tag string, name string) bool {
 	return false
 }
 
+// LookupKeyword 域名关键词匹配, 返回命中的关键词, 标签不在生效时间窗口内时不匹配
+func (dh *Datahub) LookupKeyword(tag string, name string) (string, bool) {
+	tag = strings.ToUpper(tag)
+	if !dh.tagActive(tag) {
+		return "", false
+	}
+	if list := dh.getDataTableByTag(datatable.DateTypeKeywordTable, tag); list != nil {
+		k := list.GetData().(*datatable.KeywordData)
+		if word, ok := k.MatchKeyword(name); ok {
+			if _, except := k.MatchException(name); except {
+				return "", false
+			}
+			dh.keywordMatchStat.Incr(tag, 1)
+			return word, true
+		}
+	}
+	return "", false
+}
+
 // MatchEcs 匹配 ECS IP
 func (dh *Datahub) MatchEcs(tag string, client string) net.IP {
 	tag = strings.ToUpper(tag)
@@ -145,49 +197,78 @@ func (dh *Datahub) MatchEcs(tag string, client string) net.IP {
 	return nil
 }
 
-// MixMatch 混合模式匹配域名
+// MixMatch 混合模式匹配域名, 命中同一标签域名表或关键词表中的例外规则时不匹配
 func (dh *Datahub) MixMatch(tag string, name string) bool {
 	tag = strings.ToUpper(tag)
+	if !dh.tagActive(tag) {
+		return false
+	}
+	name = netutils.NormalizeDomain(name)
 
-	bs, err := dh.matchCache.Get(tag + name)
-	if err == nil {
-		switch string(bs) {
-		case DomainMatcher:
-			dh.domainMatchStat.Incr(tag, 1)
-		case KeywordMatcher:
-			dh.keywordMatchStat.Incr(tag, 1)
+	matcher := dh.matchCache.lookup(tag, tag+name, func() string {
+		matcher := dh.mixMatchSource(tag, name)
+		if matcher == "" {
+			return ""
 		}
-		return true
+		if _, _, _, ok := dh.lookupException(tag, name); ok {
+			return ""
+		}
+		return matcher
+	})
+	switch matcher {
+	case DomainMatcher:
+		dh.domainMatchStat.Incr(tag, 1)
+	case KeywordMatcher:
+		dh.keywordMatchStat.Incr(tag, 1)
+	default:
+		return false
 	}
+	return true
+}
 
+// mixMatchSource 依次匹配自定义域名表, 关键词表, Geodat 数据, 返回命中的匹配器类型
+func (dh *Datahub) mixMatchSource(tag string, name string) string {
 	// 匹配自定义域名表
 	if list := dh.getDataTableByTag(datatable.DateTypeDomainlistTable, tag); list != nil {
 		if list.Match(name) {
-			_ = dh.matchCache.Set(tag+name, []byte(DomainMatcher))
-			dh.domainMatchStat.Incr(tag, 1)
-			return true
+			return DomainMatcher
 		}
 	}
 
 	// 匹配关键词表
 	if list := dh.getDataTableByTag(datatable.DateTypeKeywordTable, tag); list != nil {
 		if list.Match(name) {
-			_ = dh.matchCache.Set(tag+name, []byte(KeywordMatcher))
-			dh.keywordMatchStat.Incr(tag, 1)
-			return true
+			return KeywordMatcher
 		}
 	}
 
 	// 匹配 Geodat 数据
 	if list := dh.getGeoDomainListByTag(tag); list != nil {
 		if list.MixMatch(name) {
-			_ = dh.matchCache.Set(tag+name, []byte(DomainMatcher))
-			dh.domainMatchStat.Incr(tag, 1)
-			return true
+			return DomainMatcher
 		}
 	}
+	return ""
+}
 
-	return false
+// lookupException 返回域名命中的同一标签例外规则, 依次检查自定义域名表与关键词表.
+// 域名命中同一标签的 important 规则时例外规则不生效
+func (dh *Datahub) lookupException(tag string, name string) (tableType, rule, ruleType string, ok bool) {
+	if list := dh.getDataTableByTag(datatable.DateTypeDomainlistTable, tag); list != nil {
+		data := list.GetData().(*datatable.DomainData)
+		if data.MatchImportant(name) {
+			return "", "", "", false
+		}
+		if mtype, rule, ok := data.LookupException(name); ok {
+			return datatable.DateTypeDomainlistTable, rule, mtype, true
+		}
+	}
+	if list := dh.getDataTableByTag(datatable.DateTypeKeywordTable, tag); list != nil {
+		if word, ok := list.GetData().(*datatable.KeywordData).MatchException(name); ok {
+			return datatable.DateTypeKeywordTable, word, netutils.MatchKeywordType, true
+		}
+	}
+	return "", "", "", false
 }
 
 var reverseResult = func(rval, reverse bool) bool {
@@ -208,40 +289,9 @@ func (dh *Datahub) MixMatchTags(tags []string, name string, reverse bool) bool {
 	}()
 	for _, tag := range tags {
 		tag = strings.ToUpper(tag)
-		bs, err := dh.matchCache.Get(tag + name)
-		if err == nil {
-			switch string(bs) {
-			case DomainMatcher:
-				dh.domainMatchStat.Incr(tag, 1)
-			case KeywordMatcher:
-				dh.keywordMatchStat.Incr(tag, 1)
-			}
+		if dh.MixMatch(tag, name) {
 			return reverseResult(true, reverse)
 		}
-		// 匹配自定义域名表
-		if list := dh.getDataTableByTag(datatable.DateTypeDomainlistTable, tag); list != nil {
-			if list.Match(name) {
-				_ = dh.matchCache.Set(tag+name, []byte(DomainMatcher))
-				dh.domainMatchStat.Incr(tag, 1)
-				return reverseResult(true, reverse)
-			}
-		}
-		// 匹配关键词表
-		if list := dh.getDataTableByTag(datatable.DateTypeKeywordTable, tag); list != nil {
-			if list.Match(name) {
-				_ = dh.matchCache.Set(tag+name, []byte(KeywordMatcher))
-				dh.keywordMatchStat.Incr(tag, 1)
-				return reverseResult(true, reverse)
-			}
-		}
-		// 匹配 Geodat 数据
-		if list := dh.getGeoDomainListByTag(tag); list != nil {
-			if list.MixMatch(name) {
-				_ = dh.matchCache.Set(tag+name, []byte(DomainMatcher))
-				dh.domainMatchStat.Incr(tag, 1)
-				return reverseResult(true, reverse)
-			}
-		}
 		if reverse {
 			dh.domainMatchStat.Incr("!"+tag, 1)
 		}
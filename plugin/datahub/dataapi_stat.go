@@ -1,6 +1,9 @@
 package datahub
 
 import (
+	"strings"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
 	"github.com/ca17/datahub/plugin/pkg/stats"
 )
 
@@ -39,6 +42,11 @@ func (dh *Datahub) QueryTotal() int64 {
 	return dh.metricsStat.GetValue(MetricsStatDnsQuery)
 }
 
+// MatchCacheStats 查询匹配缓存统计, 包括命中, 未命中结果的命中, 未命中, 过期, 失效次数及当前条目数
+func (dh *Datahub) MatchCacheStats() []stats.Counter {
+	return append(dh.matchCache.stat.Values(), *stats.NewCounter(MatchCacheEntries, int64(dh.matchCache.Len())))
+}
+
 // MatcherStats 查询 Metrics 指标统计
 func (dh *Datahub) MatcherStats(classify string) []stats.Counter {
 	switch classify {
@@ -48,9 +56,47 @@ func (dh *Datahub) MatcherStats(classify string) []stats.Counter {
 		return dh.keywordMatchStat.Values()
 	case "network":
 		return dh.networkMatchStat.Values()
+	case "policy":
+		return dh.policyMatchStat.Values()
+	case "answer":
+		return dh.answerMatchStat.Values()
+	case "route":
+		return dh.routeMatchStat.Values()
+	case "cache":
+		return dh.MatchCacheStats()
+	case "group":
+		return dh.groupQueryStat.Values()
+	case "schedule":
+		return dh.ScheduleStats()
 	default:
 		return []stats.Counter{
 			*stats.NewCounter("unknow", 0),
 		}
 	}
 }
+
+// RegexStats 查询域名表与 geosite 中正则规则的命中次数
+func (dh *Datahub) RegexStats(tag string) []stats.Counter {
+	tag = strings.ToUpper(tag)
+	result := make([]stats.Counter, 0)
+	add := func(expr string, hits uint64) {
+		result = append(result, *stats.NewCounter(expr, int64(hits)))
+	}
+	if list := dh.getDataTableByTag(datatable.DateTypeDomainlistTable, tag); list != nil {
+		list.GetData().(*datatable.DomainData).RegexHits(add)
+	}
+	if list := dh.getGeoDomainListByTag(tag); list != nil {
+		list.RegexHits(add)
+	}
+	return result
+}
+
+// UnsupportedDomainRules 查询域名表最近一次加载中无法转换的规则, 表不存在时返回 nil
+func (dh *Datahub) UnsupportedDomainRules(tag string) *datatable.UnsupportedRules {
+	list := dh.getDataTableByTag(datatable.DateTypeDomainlistTable, tag)
+	if list == nil {
+		return nil
+	}
+	u := list.GetData().(*datatable.DomainData).Unsupported()
+	return &u
+}
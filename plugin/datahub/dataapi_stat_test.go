@@ -0,0 +1,22 @@
+package datahub
+
+import (
+	"testing"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+)
+
+func TestDatahub_RegexStats(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "ads", "ads regex ^ads\\.\nads regex \\.track\\.")
+	for _, name := range []string{"ads.example.com", "ads.example.net", "x.track.com", "www.example.com"} {
+		dh.MixMatch("ads", name)
+	}
+	hits := map[string]int64{}
+	for _, c := range dh.RegexStats("ads") {
+		hits[c.Name] = c.Value
+	}
+	if hits[`^ads\.`] != 2 || hits[`\.track\.`] != 1 {
+		t.Errorf("RegexStats = %v", hits)
+	}
+}
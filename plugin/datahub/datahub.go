@@ -4,12 +4,13 @@ import (
 	"context"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/allegro/bigcache"
 	"github.com/c-robinson/iplib"
 	"github.com/ca17/datahub/plugin/pkg/datatable"
 	"github.com/ca17/datahub/plugin/pkg/loader"
+	"github.com/ca17/datahub/plugin/pkg/mmdb"
 	"github.com/ca17/datahub/plugin/pkg/netutils"
 	"github.com/ca17/datahub/plugin/pkg/stats"
 	"github.com/ca17/datahub/plugin/pkg/v2data"
@@ -25,9 +26,11 @@ const (
 	NetworkMatcher = "network"
 	KeywordMatcher = "keyword"
 
-	MetricsStatDnsQuery = "dnsquery"
-	MetricsStatEcsHits  = "ecshits"
-	MetricsStatNxdomain = "nxdomain"
+	MetricsStatDnsQuery   = "dnsquery"
+	MetricsStatEcsHits    = "ecshits"
+	MetricsStatEcsApplied = "ecsapplied"
+	MetricsStatHostsHits  = "hostshits"
+	MetricsStatNxdomain   = "nxdomain"
 )
 
 var cronParser = cron.NewParser(
@@ -44,21 +47,36 @@ type Datahub struct {
 	netlistTableMap      cmap.ConcurrentMap
 	domainTableMap       cmap.ConcurrentMap
 	ecsTableMap          cmap.ConcurrentMap
+	hostsTableMap        cmap.ConcurrentMap
+	hostsOrder           atomic.Value // map[string][]string, 各分组本地应答表的查询顺序
+	asnTableMap          cmap.ConcurrentMap
+	tagExprMap           cmap.ConcurrentMap // 已编译的标签表达式
+	tagIndex             tagIndexHolder     // 多标签查询索引
 	//
 	Next              plugin.Handler
 	geoipCacheTags    []string
 	geositeCacheTags  []string
 	geoipPath         string
 	geositePath       string
+	geoipMmdb         *mmdb.Reader
 	geodatUpgradeUrl  string
 	geodatUpgradeCron string
 	sched             *cron.Cron
-	matchCache        *bigcache.BigCache
+	matchCache        *matchCache
 	reloadCron        string
 	pubserver         *dataServer
 	notifyServer      *notifyServer
 	jwtSecret         string
 	debug             bool
+	policies          []*policy
+	answerTags        []string
+	answerHookLock    sync.RWMutex
+	answerHooks       []AnswerHook
+	routes            []*route
+	ecsApply          *ecsApply
+	answerFilter      *answerFilter
+	groups            []*clientGroup
+	schedules         map[string]*tagSchedule // 定时生效标签, 配置完成后只读
 
 	// stat define
 	metricsStat         *stats.CounterStat // metrics 统计
@@ -67,23 +85,51 @@ type Datahub struct {
 	domainMatchStat     *stats.CounterStat // 域名标签统计
 	networkMatchStat    *stats.CounterStat // 网络标签统计
 	keywordMatchStat    *stats.CounterStat // 关键词统计
+	policyMatchStat     *stats.CounterStat // 策略动作统计
+	answerMatchStat     *stats.CounterStat // 应答 IP 标签统计
+	routeMatchStat      *stats.CounterStat // 标签路由统计
+	groupQueryStat      *stats.CounterStat // 客户端分组查询统计
 	dayaDomainChartStat *stats.DayDnsStat  // 最近24小时域名标签匹配数统计
 	dayNetworkChartStat *stats.DayDnsStat  // 最近24小时网络标签匹配数统计
 }
 
-// ServeDNS Datahub 只做简单匹配统计， 不会处理请求逻辑
+// ServeDNS Datahub 做匹配统计, 命中本地应答表或策略时直接应答, 命中路由时转发到上游, 否则交给下一个插件处理
 func (dh *Datahub) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
 	state := &request.Request{W: w, Req: r}
 	dh.metricsStat.Incr(MetricsStatDnsQuery, 1)
 	dh.queryStat.Incr(state.Name(), 1)
 	dh.clientStat.Incr(state.IP(), 1)
+	var group string
+	if g := dh.matchClientGroup(state.IP()); g != nil {
+		group = g.name
+		dh.groupQueryStat.Incr(group, 1)
+		g.clientStat.Incr(state.IP(), 1)
+	}
+	name := netutils.NormalizeDomain(state.Name())
+	if answer, found := dh.lookupHosts(group, name, state.QType()); found {
+		return dh.serveHosts(answer, state)
+	}
+	if p := dh.matchPolicy(group, name); p != nil {
+		return dh.servePolicy(p, group, state)
+	}
+	if dh.ecsApply != nil {
+		var synthesized bool
+		if r, synthesized = dh.applyEcs(group, state); synthesized {
+			w = &ecsResponseWriter{ResponseWriter: w}
+		}
+	}
+	if len(dh.answerTags) > 0 || dh.answerFilter != nil {
+		w = &responseWriter{ResponseWriter: w, hub: dh, state: state}
+	}
+	if rt := dh.matchRoute(group, name); rt != nil {
+		return dh.serveRoute(ctx, rt, group, w, r)
+	}
 	return plugin.NextOrFailure(dh.Name(), dh.Next, ctx, w, r)
 }
 
 func (dh *Datahub) Name() string { return "datahub" }
 
 func NewDatahub() *Datahub {
-	mc, _ := bigcache.NewBigCache(bigcache.DefaultConfig(time.Second * 300))
 	hub := &Datahub{
 		geonlmLock:           sync.RWMutex{},
 		geodlmLock:           sync.RWMutex{},
@@ -93,19 +139,29 @@ func NewDatahub() *Datahub {
 		netlistTableMap:      cmap.New(),
 		domainTableMap:       cmap.New(),
 		ecsTableMap:          cmap.New(),
-		matchCache:           mc,
+		hostsTableMap:        cmap.New(),
+		asnTableMap:          cmap.New(),
+		tagExprMap:           cmap.New(),
 		notifyServer:         newNotifyServer(),
 		sched:                cron.New(cron.WithParser(cronParser)),
 		// stat
 		domainMatchStat:     stats.NewCounterStat(),
 		networkMatchStat:    stats.NewCounterStat(),
 		keywordMatchStat:    stats.NewCounterStat(),
+		policyMatchStat:     stats.NewCounterStat(),
+		answerMatchStat:     stats.NewCounterStat(),
+		routeMatchStat:      stats.NewCounterStat(),
+		groupQueryStat:      stats.NewCounterStat(),
 		metricsStat:         stats.NewCounterStat(),
 		queryStat:           stats.NewCounterStat(),
 		clientStat:          stats.NewCounterStat(),
 		dayaDomainChartStat: stats.NewDayDnsStat(time.Hour * 24),
 		dayNetworkChartStat: stats.NewDayDnsStat(time.Hour * 24),
 	}
+	var err error
+	if hub.matchCache, err = newMatchCache(defaultMatchCacheTTL, 0); err != nil {
+		log.Errorf("%s, match cache disabled", err.Error())
+	}
 	hub.pubserver = newPubServer(hub)
 	return hub
 }
@@ -141,6 +197,14 @@ func (dh *Datahub) getDataTableByTag(dtyope string, tag string) *datatable.DataT
 		if v, ok := dh.domainTableMap.Get(tag); ok {
 			return v.(*datatable.DataTable)
 		}
+	case datatable.DateTypeHostsTable:
+		if v, ok := dh.hostsTableMap.Get(tag); ok {
+			return v.(*datatable.DataTable)
+		}
+	case datatable.DateTypeAsnTable:
+		if v, ok := dh.asnTableMap.Get(tag); ok {
+			return v.(*datatable.DataTable)
+		}
 	}
 	return nil
 }
@@ -159,77 +223,132 @@ func (dh *Datahub) reloadGeoipNetListByTag(tags []string, cache bool) error {
 	for _, dataitems := range tagitems {
 		var nets []iplib.Net
 		for _, data := range dataitems.GetCidr() {
-			_net := iplib.NewNet(data.GetIp(), int(data.GetPrefix()))
+			_net := netutils.NewIPNet(data.GetIp(), int(data.GetPrefix()))
 			nets = append(nets, _net)
 		}
 
 		dh.geoipNetListMap[dataitems.GetCountryCode()] = netutils.NewNetList(nets)
-
+		dh.matchCache.invalidate(dataitems.GetCountryCode())
 	}
 	return nil
 }
 
-// 根据 tag 从 geosite.dat 加载 geosite 数据
+// 根据 tag 从 geosite.dat 加载 geosite 数据, tag 支持 `tag@attr` 与 `tag@!attr` 属性选择器
 func (dh *Datahub) reloadGeositeDmoainListByTag(tags []string, cache bool) error {
 	if !cache {
 		loader.RemoveCache(dh.geositePath)
 	}
-	tagitems, err := loader.LoadGeoSiteFromDATByTags(dh.geositePath, tags)
+	var codes []string
+	for _, tag := range tags {
+		code, _, _ := loader.ParseGeoSiteSelector(tag)
+		codes = append(codes, code)
+	}
+	tagitems, err := loader.LoadGeoSiteFromDATByTags(dh.geositePath, codes)
 	if err != nil {
 		return err
 	}
-	dh.geodlmLock.Lock()
-	defer dh.geodlmLock.Unlock()
+	sites := make(map[string]*v2data.GeoSite)
 	for _, dataitems := range tagitems {
-		var sites []string
-		var regexs []string
-		for _, data := range dataitems.GetDomain() {
+		sites[strings.ToUpper(dataitems.GetCountryCode())] = dataitems
+	}
+	lists := make(map[string]*netutils.DomainList)
+	for _, tag := range tags {
+		code, attrs, excludes := loader.ParseGeoSiteSelector(tag)
+		site, ok := sites[strings.ToUpper(code)]
+		if !ok {
+			continue
+		}
+		var keywords, regexs []string
+		dmlist := netutils.NewDomainList()
+		for _, data := range loader.FilterGeoSiteDomains(site, attrs, excludes) {
 			switch data.Type {
-			case v2data.Domain_Full, v2data.Domain_Domain:
-				sites = append(sites, data.GetValue())
+			case v2data.Domain_Full:
+				dmlist.Add(netutils.MatchFullType, data.GetValue())
+			case v2data.Domain_Domain:
+				dmlist.Add(netutils.MatchDomainType, data.GetValue())
+			case v2data.Domain_Plain:
+				keywords = append(keywords, data.GetValue())
 			case v2data.Domain_Regex:
 				regexs = append(regexs, data.GetValue())
 			}
 		}
-		dmlist := netutils.NewDomainList()
-		dmlist.InitDomainData(netutils.MatchFullType, sites)
+		dmlist.InitDomainData(netutils.MatchKeywordType, keywords)
 		dmlist.InitDomainData(netutils.MatchRegexType, regexs)
-		dh.geositeDoaminListMap[dataitems.GetCountryCode()] = dmlist
+		lists[strings.ToUpper(tag)] = dmlist
+	}
+	dh.geodlmLock.Lock()
+	defer dh.geodlmLock.Unlock()
+	for k, v := range lists {
+		dh.geositeDoaminListMap[k] = v
+		dh.matchCache.invalidate(k)
 	}
 	return nil
 }
 
 func (dh *Datahub) parseDataTableByTag(datatype string, tags []string, from string) {
+	dh.parseGroupDataTableByTag("", datatype, tags, from)
+}
+
+// parseGroupDataTableByTag 加载数据表, group 不为空时数据表只对该客户端分组生效
+func (dh *Datahub) parseGroupDataTableByTag(group string, datatype string, tags []string, from string) {
 	for _, tag := range tags {
 		tag = strings.ToUpper(tag)
+		key := groupTag(group, tag)
 		switch datatype {
 		case datatable.DateTypeKeywordTable:
-			table := datatable.NewFromArgs(datatable.DateTypeKeywordTable, tag, from)
-			table.SetJwtSecret(dh.jwtSecret)
-			table.SetBootstrap(dh.bootstrap)
-			table.LoadAll()
-			dh.keywordTableMap.Set(tag, table)
+			dh.keywordTableMap.Set(key, dh.loadDataTable(key, datatype, tag, from))
 		case datatable.DateTypeDomainlistTable:
-			table := datatable.NewFromArgs(datatable.DateTypeDomainlistTable, tag, from)
-			table.SetJwtSecret(dh.jwtSecret)
-			table.SetBootstrap(dh.bootstrap)
-			table.LoadAll()
-			dh.domainTableMap.Set(tag, table)
+			dh.domainTableMap.Set(key, dh.loadDataTable(key, datatype, tag, from))
 		case datatable.DateTypeNetlistTable:
-			table := datatable.NewFromArgs(datatable.DateTypeNetlistTable, tag, from)
-			table.SetJwtSecret(dh.jwtSecret)
-			table.SetBootstrap(dh.bootstrap)
-			table.LoadAll()
-			dh.netlistTableMap.Set(tag, table)
+			dh.netlistTableMap.Set(key, dh.loadDataTable(key, datatype, tag, from))
 		case datatable.DateTypeEcsTable:
-			table := datatable.NewFromArgs(datatable.DateTypeEcsTable, tag, from)
-			table.SetJwtSecret(dh.jwtSecret)
-			table.SetBootstrap(dh.bootstrap)
-			table.LoadAll()
-			dh.ecsTableMap.Set(tag, table)
+			dh.ecsTableMap.Set(key, dh.loadDataTable(key, datatype, tag, from))
+		case datatable.DateTypeHostsTable:
+			dh.hostsTableMap.Set(key, dh.loadDataTable(key, datatype, tag, from))
+			dh.updateHostsOrder()
+		case datatable.DateTypeAsnTable:
+			dh.asnTableMap.Set(key, dh.loadDataTable(key, datatype, tag, from))
+			dh.invalidateNetlistASN()
+		default:
+			continue
 		}
+		dh.matchCache.invalidate(key)
 	}
+}
 
+// parseGroupDomainTableByTag 按指定格式加载域名表, format 为 auto, native 或 abp
+func (dh *Datahub) parseGroupDomainTableByTag(group string, tags []string, from string, format string) {
+	for _, tag := range tags {
+		tag = strings.ToUpper(tag)
+		key := groupTag(group, tag)
+		table := dh.newDataTable(key, datatable.DateTypeDomainlistTable, tag, from)
+		table.GetData().(*datatable.DomainData).SetFormat(format)
+		table.LoadAll()
+		dh.domainTableMap.Set(key, table)
+		dh.matchCache.invalidate(key)
+	}
+}
+
+// loadDataTable 创建并加载数据表, 数据表重新加载时使 key 的匹配缓存失效
+func (dh *Datahub) loadDataTable(key string, datatype string, tag string, from string) *datatable.DataTable {
+	table := dh.newDataTable(key, datatype, tag, from)
+	table.LoadAll()
+	return table
+}
+
+// newDataTable 创建数据表, 不加载数据
+func (dh *Datahub) newDataTable(key string, datatype string, tag string, from string) *datatable.DataTable {
+	table := datatable.NewFromArgs(datatype, tag, from)
+	table.SetJwtSecret(dh.jwtSecret)
+	table.SetBootstrap(dh.bootstrap)
+	table.SetOnChange(func() {
+		dh.matchCache.invalidate(key)
+		if datatype == datatable.DateTypeAsnTable {
+			dh.invalidateNetlistASN()
+		}
+		dh.rebuildTagIndex()
+	})
+	return table
 }
 
 func (dh *Datahub) OnStartup() error {
@@ -239,6 +358,7 @@ func (dh *Datahub) OnStartup() error {
 	log.Infof("pubserver is running %s", dh.pubserver.listenAddr)
 	dh.startSched()
 	log.Infof("sched is running")
+	dh.rebuildTagIndex()
 	return nil
 }
 
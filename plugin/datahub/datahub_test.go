@@ -1,15 +1,29 @@
 package datahub
 
 import (
+	"fmt"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/c-robinson/iplib"
 	"github.com/ca17/datahub/plugin/pkg/datatable"
 	"github.com/ca17/datahub/plugin/pkg/netutils"
+	"github.com/coredns/coredns/plugin/test"
 	"github.com/miekg/dns"
 )
 
+// loadTestTable 将 content 写入临时文件并作为数据表加载
+func loadTestTable(t testing.TB, dh *Datahub, datatype string, tag string, content string) {
+	fname, rm, err := test.TempFile(t.TempDir(), content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(rm)
+	dh.parseDataTableByTag(datatype, []string{tag}, fname)
+}
+
 func TestDatahub_MatchGeoip(t *testing.T) {
 	dh := NewDatahub()
 	dh.geoipPath = "../../data/geoip.dat"
@@ -38,16 +52,53 @@ func TestDatahub_MatchGeosite(t *testing.T) {
 
 func TestDatahub_MatchKeyword(t *testing.T) {
 	dh := NewDatahub()
-	dh.parseDataTableByTag(datatable.DateTypeKeywordTable, "cn", "../../data/keyword_cn.txt")
+	dh.parseDataTableByTag(datatable.DateTypeKeywordTable, []string{"cn"}, "../../data/keyword_cn.txt")
 	t.Log(dh.MatchKeyword("cn", "www.baidu.com"))
 }
 
 func TestDatahub_MatchEcs(t *testing.T) {
 	dh := NewDatahub()
-	dh.parseDataTableByTag(datatable.DateTypeEcsTable, "global", "../../data/ecs_table.txt")
+	dh.parseDataTableByTag(datatable.DateTypeEcsTable, []string{"global"}, "../../data/ecs_table.txt")
 	t.Log(dh.MatchEcs("global", "127.0.0.1"))
 }
 
+func TestDatahub_MatchIPv6(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "lan", "lan 10.0.0.0/8\nlan fd00::/8\nlan 2001:db8:1::/48")
+	for ip, want := range map[string]bool{
+		"10.1.1.1": true, "::ffff:10.1.1.1": true, "fd12::1": true,
+		"2001:db8:1:2::1": true, "2001:db8:2::1": false, "11.0.0.1": false,
+	} {
+		if got := dh.MixMatchNetByStr("lan", ip); got != want {
+			t.Errorf("MixMatchNetByStr(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	loadTestTable(t, dh, datatable.DateTypeEcsTable, "global",
+		"global 2001:db8::/32 2400:da00::6666\nglobal 10.0.0.0/8 114.114.114.114\nglobal 2001:db8::53 2400:da00::1")
+	for client, want := range map[string]string{
+		"2001:db8:5::1":   "2400:da00::6666",
+		"2001:db8::53":    "2400:da00::1",
+		"::ffff:10.9.9.9": "114.114.114.114",
+	} {
+		if got := dh.MatchEcs("global", client); got == nil || got.String() != want {
+			t.Errorf("MatchEcs(%s) = %v, want %s", client, got, want)
+		}
+	}
+
+	dh.geoipNetListMap["TEST"] = netutils.NewNetList([]iplib.Net{
+		netutils.NewIPNet(net.ParseIP("2001:db8::"), 32),
+		netutils.NewIPNet(net.ParseIP("192.0.2.0").To4(), 24),
+	})
+	for ip, want := range map[string]bool{
+		"2001:db8::1": true, "2001:db9::1": false, "192.0.2.1": true, "::ffff:192.0.2.1": true,
+	} {
+		if got := dh.MatchGeoip("test", net.ParseIP(ip)); got != want {
+			t.Errorf("MatchGeoip(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
 func BenchmarkMatchGeositeFull(b *testing.B) {
 	dh := NewDatahub()
 	dh.geositePath = "../../data/geosite.dat"
@@ -60,6 +111,18 @@ func BenchmarkMatchGeositeFull(b *testing.B) {
 	}
 }
 
+func BenchmarkMatchGeositeDomain(b *testing.B) {
+	dh := NewDatahub()
+	dh.geositePath = "../../data/geosite.dat"
+	err := dh.reloadGeositeDmoainListByTag([]string{"google", "apple", "hk", "cn"}, true)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for n := 0; n < b.N; n++ {
+		dh.MatchGeosite(netutils.MatchDomainType, "google", "www.google.cn")
+	}
+}
+
 func BenchmarkMatchGeositeRegex(b *testing.B) {
 	dh := NewDatahub()
 	dh.geositePath = "../../data/geosite.dat"
@@ -72,22 +135,133 @@ func BenchmarkMatchGeositeRegex(b *testing.B) {
 	}
 }
 
+func BenchmarkMatchDomainRegex(b *testing.B) {
+	dh := NewDatahub()
+	var lines []string
+	for i := 0; i < 2000; i++ {
+		lines = append(lines, fmt.Sprintf("ads regex (^|\\.)ad%d\\.example\\.com$", i))
+	}
+	loadTestTable(b, dh, datatable.DateTypeDomainlistTable, "ads", strings.Join(lines, "\n"))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		dh.MixMatch("ads", fmt.Sprintf("adservice%d.google.com", n))
+	}
+}
+
 func BenchmarkMatchKeyword(b *testing.B) {
 	dh := NewDatahub()
-	dh.parseDataTableByTag(datatable.DateTypeKeywordTable, "cn", "../../data/keyword_cn.txt")
+	dh.parseDataTableByTag(datatable.DateTypeKeywordTable, []string{"cn"}, "../../data/keyword_cn.txt")
 	for n := 0; n < b.N; n++ {
 		dh.MatchKeyword("cn", "www.baidu.com")
 	}
 }
 
+func BenchmarkMatchKeywordLarge(b *testing.B) {
+	dh := NewDatahub()
+	var lines []string
+	for i := 0; i < 50000; i++ {
+		lines = append(lines, fmt.Sprintf("large keyword%d", i))
+	}
+	loadTestTable(b, dh, datatable.DateTypeKeywordTable, "large", strings.Join(lines, "\n"))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		dh.MatchKeyword("large", "www.baidu.com")
+	}
+}
+
+func TestDatahub_LookupKeyword(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeKeywordTable, "ads", "ads doubleclick\nads adservice")
+	word, ok := dh.LookupKeyword("ads", "stats.doubleclick.net")
+	if !ok || word != "doubleclick" {
+		t.Errorf("LookupKeyword = %s,%v", word, ok)
+	}
+	if _, ok := dh.LookupKeyword("ads", "www.example.com"); ok {
+		t.Fail()
+	}
+}
+
+func TestDatahub_MatchNormalize(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "cn",
+		"cn domain Example.CN.\ncn full 例子.测试\ncn full xn--bcher-kva.example\n")
+	loadTestTable(t, dh, datatable.DateTypeKeywordTable, "ads", "ads DoubleClick\n")
+	loadTestTable(t, dh, datatable.DateTypeHostsTable, "local", "10.0.0.1 Printer.LAN.\n")
+	for _, name := range []string{"www.example.cn", "WWW.Example.cn.", "例子.测试", "XN--FSQU00A.xn--0zwm56d.", "Bücher.example"} {
+		if !dh.MixMatch("cn", name) {
+			t.Errorf("MixMatch(%s) should match", name)
+		}
+	}
+	for _, name := range []string{"stats.doubleclick.net", "Stats.DOUBLECLICK.net."} {
+		if !dh.MatchKeyword("ads", name) {
+			t.Errorf("MatchKeyword(%s) should match", name)
+		}
+	}
+	if e := dh.Explain("cn", "WWW.例子.测试."); e.Matched {
+		t.Errorf("Explain subdomain of full rule = %+v", e)
+	}
+	if e := dh.Explain("cn", "例子.测试."); !e.Matched || e.Rule != "xn--fsqu00a.xn--0zwm56d" {
+		t.Errorf("Explain = %+v", e)
+	}
+	if answer, found := dh.lookupHosts("", "PRINTER.lan.", dns.TypeA); !found || len(answer) != 1 {
+		t.Errorf("lookupHosts = %v %v", answer, found)
+	}
+}
+
 func BenchmarkMatchEcs(b *testing.B) {
 	dh := NewDatahub()
-	dh.parseDataTableByTag(datatable.DateTypeEcsTable, "global", "../../data/ecs_table.txt")
+	dh.parseDataTableByTag(datatable.DateTypeEcsTable, []string{"global"}, "../../data/ecs_table.txt")
 	for n := 0; n < b.N; n++ {
 		dh.MatchEcs("global", "127.0.0.1")
 	}
 }
 
+func TestDatahub_DomainTableAppend(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "ads", "ads domain a.com\n")
+	data := dh.getDataTableByTag(datatable.DateTypeDomainlistTable, "ads").GetData().(*datatable.DomainData)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			data.ParseLines([]string{fmt.Sprintf("s%d.b.com", i)}, false)
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		data.Match(fmt.Sprintf("x.s%d.b.com", i))
+		data.Lookup("www.a.com")
+	}
+	<-done
+	if !data.Match("www.a.com") || !data.Match("x.s199.b.com") || data.Len() != 201 {
+		t.Errorf("append rules error, len %d", data.Len())
+	}
+}
+
+func TestDatahub_DomainTableReloadAtomic(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "ads", "")
+	data := dh.getDataTableByTag(datatable.DateTypeDomainlistTable, "ads").GetData().(*datatable.DomainData)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			// 规则与例外规则同时生效, 任何时刻都不应命中
+			data.ParseLines([]string{"a.com", "@@a.com"}, true)
+			data.ParseLines(nil, true)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if data.Match("www.a.com") {
+			t.Fatal("matched rules from different loads")
+		}
+	}
+}
+
 func Test_dnslable(t *testing.T) {
 	s := "www.google.com"
 	i, b := dns.NextLabel(s, 0)
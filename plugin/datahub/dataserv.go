@@ -1,6 +1,8 @@
 package datahub
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/c-robinson/iplib"
@@ -90,6 +92,33 @@ func (s *dataServer) listDomainBytag(c *routing.Context) error {
 	return nil
 }
 
+func (s *dataServer) listAsnBytag(c *routing.Context) error {
+	tag := c.Param("tag")
+	if tag == "" {
+		c.Error("tag is empty", http.StatusBadRequest)
+	}
+	limit, err := c.QueryArgs().GetUint("limit")
+	if err != nil {
+		limit = 1000
+	}
+	s.fetchDataTable(c, datatable.DateTypeAsnTable, tag, limit)
+	return nil
+}
+
+func (s *dataServer) lookupASN(c *routing.Context) error {
+	ip := c.Param("ip")
+	if ip == "" {
+		c.Error("ip is empty", http.StatusBadRequest)
+		return nil
+	}
+	info := s.hub.LookupASN(ip)
+	if info == nil {
+		c.Error("asn not found", http.StatusNotFound)
+		return nil
+	}
+	return s.writeJSON(c, info)
+}
+
 func (s *dataServer) listKeywordsBytag(c *routing.Context) error {
 	tag := c.Param("tag")
 	if tag == "" {
@@ -103,13 +132,142 @@ func (s *dataServer) listKeywordsBytag(c *routing.Context) error {
 	return nil
 }
 
-func (s *dataServer) start() error {
+func (s *dataServer) listHostsBytag(c *routing.Context) error {
+	tag := c.Param("tag")
+	if tag == "" {
+		c.Error("tag is empty", http.StatusBadRequest)
+	}
+	limit, err := c.QueryArgs().GetUint("limit")
+	if err != nil {
+		limit = 1000
+	}
+	s.fetchDataTable(c, datatable.DateTypeHostsTable, tag, limit)
+	return nil
+}
+
+func (s *dataServer) listRegexStatsBytag(c *routing.Context) error {
+	tag := c.Param("tag")
+	if tag == "" {
+		c.Error("tag is empty", http.StatusBadRequest)
+	}
+	for _, counter := range s.hub.RegexStats(tag) {
+		_, _ = c.WriteString(fmt.Sprintf("%d %s\n", counter.Value, counter.Name))
+	}
+	return nil
+}
+
+func (s *dataServer) listUnsupportedBytag(c *routing.Context) error {
+	tag := c.Param("tag")
+	if tag == "" {
+		c.Error("tag is empty", http.StatusBadRequest)
+		return nil
+	}
+	u := s.hub.UnsupportedDomainRules(tag)
+	if u == nil {
+		c.Error("domain_table not found", http.StatusNotFound)
+		return nil
+	}
+	return s.writeJSON(c, u)
+}
+
+func (s *dataServer) writeJSON(c *routing.Context, v interface{}) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		c.Error(err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	c.SetContentType(MIMEApplicationJSONCharsetUTF8)
+	_, _ = c.Write(bs)
+	return nil
+}
+
+func (s *dataServer) explainDomain(c *routing.Context) error {
+	tag, name := c.Param("tag"), c.Param("name")
+	if tag == "" || name == "" {
+		c.Error("tag or name is empty", http.StatusBadRequest)
+		return nil
+	}
+	return s.writeJSON(c, s.hub.Explain(tag, name))
+}
+
+func (s *dataServer) explainNet(c *routing.Context) error {
+	tag, ip := c.Param("tag"), c.Param("ip")
+	if tag == "" || ip == "" {
+		c.Error("tag or ip is empty", http.StatusBadRequest)
+		return nil
+	}
+	return s.writeJSON(c, s.hub.ExplainNet(tag, ip))
+}
+
+func (s *dataServer) tagsOfDomain(c *routing.Context) error {
+	name := c.Param("name")
+	if name == "" {
+		c.Error("name is empty", http.StatusBadRequest)
+		return nil
+	}
+	return s.writeJSON(c, s.hub.TagsOf(name))
+}
+
+func (s *dataServer) tagsOfNet(c *routing.Context) error {
+	ip := c.Param("ip")
+	if ip == "" {
+		c.Error("ip is empty", http.StatusBadRequest)
+		return nil
+	}
+	return s.writeJSON(c, s.hub.TagsOfIP(ip))
+}
+
+func (s *dataServer) listSchedules(c *routing.Context) error {
+	return s.writeJSON(c, s.hub.ScheduleStates())
+}
+
+func (s *dataServer) listMatchCacheStats(c *routing.Context) error {
+	return s.writeJSON(c, s.hub.MatchCacheStats())
+}
+
+func (s *dataServer) listGroupStats(c *routing.Context) error {
+	return s.writeJSON(c, s.hub.MatcherStats("group"))
+}
+
+func (s *dataServer) groupStats(c *routing.Context) error {
+	name := c.Param("name")
+	if name == "" {
+		c.Error("name is empty", http.StatusBadRequest)
+		return nil
+	}
+	st := s.hub.GroupStat(name)
+	if st == nil {
+		c.Error("client_group not found", http.StatusNotFound)
+		return nil
+	}
+	return s.writeJSON(c, st)
+}
+
+// routes 注册数据服务接口
+func (s *dataServer) routes() {
 	if s.router == nil {
 		s.router = routing.New()
 	}
 	s.router.Get("/net/list/<tag>", s.listNetBytag)
 	s.router.Get("/domain/list/<tag>", s.listDomainBytag)
 	s.router.Get("/keyword/list/<tag>", s.listKeywordsBytag)
+	s.router.Get("/hosts/list/<tag>", s.listHostsBytag)
+	s.router.Get("/asn/list/<tag>", s.listAsnBytag)
+	s.router.Get("/asn/lookup/<ip>", s.lookupASN)
+	s.router.Get("/regex/stats/<tag>", s.listRegexStatsBytag)
+	s.router.Get("/domain/unsupported/<tag>", s.listUnsupportedBytag)
+	s.router.Get("/explain/domain/<tag>/<name>", s.explainDomain)
+	s.router.Get("/explain/net/<tag>/<ip>", s.explainNet)
+	s.router.Get("/tags/domain/<name>", s.tagsOfDomain)
+	s.router.Get("/tags/net/<ip>", s.tagsOfNet)
+	s.router.Get("/cache/stats", s.listMatchCacheStats)
+	s.router.Get("/schedule/list", s.listSchedules)
+	s.router.Get("/group/stats", s.listGroupStats)
+	s.router.Get("/group/stats/<name>", s.groupStats)
+}
+
+func (s *dataServer) start() error {
+	s.routes()
 	s.server = &fasthttp.Server{
 		Handler: s.router.HandleRequest,
 	}
@@ -0,0 +1,150 @@
+package datahub
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+const (
+	EcsModeReplace = "replace"
+	EcsModeKeep    = "keep"
+	EcsModeStrip   = "strip"
+
+	ecsDefaultPrefix4 = 24
+	ecsDefaultPrefix6 = 56
+)
+
+// ecsApply 根据 ecs_table 为查询附加 EDNS0 Client Subnet
+type ecsApply struct {
+	tag     string
+	prefix4 uint8
+	prefix6 uint8
+	mode    string
+}
+
+// newEcsApply 解析配置, 格式为 `ecs_apply tag [source_prefix_v4] [source_prefix_v6] [replace|keep|strip]`
+func newEcsApply(tag string, args []string) (*ecsApply, error) {
+	e := &ecsApply{tag: tag, prefix4: ecsDefaultPrefix4, prefix6: ecsDefaultPrefix6, mode: EcsModeReplace}
+	var prefixs []uint8
+	for _, arg := range args {
+		switch arg {
+		case EcsModeReplace, EcsModeKeep, EcsModeStrip:
+			e.mode = arg
+			continue
+		}
+		v, err := strconv.ParseUint(arg, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("ecs_apply arg %s error", arg)
+		}
+		prefixs = append(prefixs, uint8(v))
+	}
+	if len(prefixs) > 2 {
+		return nil, fmt.Errorf("ecs_apply too many source prefix")
+	}
+	if len(prefixs) > 0 {
+		e.prefix4 = prefixs[0]
+	}
+	if len(prefixs) > 1 {
+		e.prefix6 = prefixs[1]
+	}
+	if e.prefix4 > 32 || e.prefix6 > 128 {
+		return nil, fmt.Errorf("ecs_apply source prefix out of range")
+	}
+	return e, nil
+}
+
+func (e *ecsApply) String() string {
+	return fmt.Sprintf("%s /%d /%d %s", e.tag, e.prefix4, e.prefix6, e.mode)
+}
+
+// subnet 构造 ECS 选项, 地址按源前缀截断
+func (e *ecsApply) subnet(ip net.IP) *dns.EDNS0_SUBNET {
+	opt := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET}
+	if ip4 := ip.To4(); ip4 != nil {
+		opt.Family = 1
+		opt.SourceNetmask = e.prefix4
+		opt.Address = ip4.Mask(net.CIDRMask(int(e.prefix4), 32))
+	} else {
+		opt.Family = 2
+		opt.SourceNetmask = e.prefix6
+		opt.Address = ip.Mask(net.CIDRMask(int(e.prefix6), 128))
+	}
+	return opt
+}
+
+// clientSubnet 返回客户端在请求中携带的 ECS 选项
+func clientSubnet(r *dns.Msg) *dns.EDNS0_SUBNET {
+	if o := r.IsEdns0(); o != nil {
+		for _, s := range o.Option {
+			if e, ok := s.(*dns.EDNS0_SUBNET); ok {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// removeSubnet 移除请求中的 ECS 选项
+func removeSubnet(r *dns.Msg) {
+	o := r.IsEdns0()
+	if o == nil {
+		return
+	}
+	opts := o.Option[:0]
+	for _, s := range o.Option {
+		if _, ok := s.(*dns.EDNS0_SUBNET); !ok {
+			opts = append(opts, s)
+		}
+	}
+	o.Option = opts
+}
+
+// applyEcs 在转发前为查询添加或替换 ECS 选项, 分组内存在 ECS 表时使用分组 ECS 表.
+// 修改在请求副本上进行, state.Req 保持不变, 以便按客户端原始 EDNS0 状态整理应答;
+// 客户端请求不含 OPT 记录时返回的 synthesized 为 true, 应答需移除 OPT 记录
+func (dh *Datahub) applyEcs(group string, state *request.Request) (req *dns.Msg, synthesized bool) {
+	e := dh.ecsApply
+	r := state.Req
+	client := clientSubnet(r)
+	if e.mode == EcsModeKeep && client != nil {
+		return r, false
+	}
+	ecsip := dh.MatchEcs(dh.resolveGroupTag(group, e.tag), state.IP())
+	if ecsip == nil && (e.mode != EcsModeStrip || client == nil) {
+		return r, false
+	}
+	r = r.Copy()
+	removeSubnet(r)
+	if ecsip == nil {
+		return r, false
+	}
+	o := r.IsEdns0()
+	if o == nil {
+		r.SetEdns0(dns.DefaultMsgSize, false)
+		o = r.IsEdns0()
+		synthesized = true
+	}
+	o.Option = append(o.Option, e.subnet(ecsip))
+	dh.metricsStat.Incr(MetricsStatEcsApplied, 1)
+	return r, synthesized
+}
+
+// ecsResponseWriter 移除应答中的 OPT 记录, 用于客户端请求不含 OPT 而转发时附加了 ECS 的情况
+type ecsResponseWriter struct {
+	dns.ResponseWriter
+}
+
+func (w *ecsResponseWriter) WriteMsg(res *dns.Msg) error {
+	extra := res.Extra[:0:0]
+	for _, rr := range res.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			extra = append(extra, rr)
+		}
+	}
+	res.Extra = extra
+	return w.ResponseWriter.WriteMsg(res)
+}
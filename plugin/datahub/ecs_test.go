@@ -0,0 +1,125 @@
+package datahub
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestDatahub_ServeDNSEcsApply(t *testing.T) {
+	clientEcs := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP("8.8.8.0").To4()}
+	tests := []struct {
+		mode   string
+		client *dns.EDNS0_SUBNET
+		want   string
+	}{
+		{EcsModeReplace, nil, "114.114.114.0"},
+		{EcsModeReplace, clientEcs, "114.114.114.0"},
+		{EcsModeKeep, clientEcs, "8.8.8.0"},
+		{EcsModeKeep, nil, "114.114.114.0"},
+		{EcsModeStrip, clientEcs, "114.114.114.0"},
+	}
+	for _, tc := range tests {
+		dh := NewDatahub()
+		loadTestTable(t, dh, datatable.DateTypeEcsTable, "global", "global 10.240.0.0/16 114.114.114.114\n")
+		e, err := newEcsApply("global", []string{"24", "56", tc.mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dh.ecsApply = e
+		var got *dns.EDNS0_SUBNET
+		dh.Next = test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+			got = clientSubnet(r)
+			return dns.RcodeSuccess, nil
+		})
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		if tc.client != nil {
+			m.SetEdns0(4096, false)
+			o := m.IsEdns0()
+			o.Option = append(o.Option, tc.client)
+		}
+		if _, err := dh.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), m); err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.Address.String() != tc.want {
+			t.Errorf("mode %s: ecs %v, want %s", tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestDatahub_ServeDNSEcsStrip(t *testing.T) {
+	dh := NewDatahub()
+	e, err := newEcsApply("global", []string{EcsModeStrip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dh.ecsApply = e
+	dh.Next = test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		if s := clientSubnet(r); s != nil {
+			t.Errorf("client ecs not stripped %v", s)
+		}
+		return dns.RcodeSuccess, nil
+	})
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	m.SetEdns0(4096, false)
+	o := m.IsEdns0()
+	o.Option = append(o.Option, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP("8.8.8.0")})
+	if _, err := dh.ServeDNS(context.Background(), dnstest.NewRecorder(&test.ResponseWriter{}), m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatahub_ServeDNSEcsNoEdns(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeEcsTable, "global", "global 10.240.0.0/16 114.114.114.114\n")
+	e, err := newEcsApply("global", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dh.ecsApply = e
+	dh.Next = test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		if s := clientSubnet(r); s == nil || s.Address.String() != "114.114.114.0" {
+			t.Errorf("forwarded ecs %v", s)
+		}
+		// 上游应答携带 OPT 记录
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.SetEdns0(4096, false)
+		return dns.RcodeSuccess, w.WriteMsg(m)
+	})
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := dh.ServeDNS(context.Background(), rec, m); err != nil {
+		t.Fatal(err)
+	}
+	if m.IsEdns0() != nil {
+		t.Error("client request should not be modified")
+	}
+	if rec.Msg == nil || rec.Msg.IsEdns0() != nil {
+		t.Errorf("synthesized OPT should be removed from response %v", rec.Msg)
+	}
+}
+
+func Test_newEcsApply(t *testing.T) {
+	e, err := newEcsApply("global", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.prefix4 != ecsDefaultPrefix4 || e.prefix6 != ecsDefaultPrefix6 || e.mode != EcsModeReplace {
+		t.Errorf("ecs_apply default %v", e)
+	}
+	for _, args := range [][]string{{"33"}, {"24", "129"}, {"24", "56", "48"}, {"drop"}} {
+		if _, err := newEcsApply("global", args); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package datahub
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/c-robinson/iplib"
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+)
+
+const (
+	ExplainTableGeosite = "geosite"
+	ExplainTableGeoip   = "geoip"
+)
+
+// Explanation 匹配解释, 说明域名或地址命中了哪个数据表的哪条规则
+type Explanation struct {
+	Tag       string `json:"tag"`
+	Query     string `json:"query"`
+	Matched   bool   `json:"matched"`
+	TableType string `json:"table_type,omitempty"` // domain_table, keyword_table, netlist_table, geosite, geoip
+	Source    string `json:"source,omitempty"`     // 文件路径, URL, inline 或 geodat 文件路径
+	Rule      string `json:"rule,omitempty"`
+	RuleType  string `json:"rule_type,omitempty"` // full, domain, regex, keyword, cidr
+	Cached    bool   `json:"cached"`
+	// 命中的例外规则, 存在时 Matched 为 false, Rule 为被覆盖的规则
+	ExceptTable string `json:"except_table,omitempty"`
+	Except      string `json:"except,omitempty"`
+	ExceptType  string `json:"except_type,omitempty"`
+	// 标签配置了时间窗口且当前未生效, 此时 Matched 为 false
+	Inactive bool `json:"inactive,omitempty"`
+}
+
+// Explain 按 MixMatch 的顺序解释域名匹配结果, 不计入匹配统计
+func (dh *Datahub) Explain(tag string, name string) *Explanation {
+	tag = strings.ToUpper(tag)
+	name = netutils.NormalizeDomain(name)
+	e := dh.explainRule(tag, name)
+	if !dh.tagActive(tag) {
+		e.Matched, e.Inactive = false, true
+		return e
+	}
+	if e.Matched {
+		if table, rule, rtype, ok := dh.lookupException(tag, name); ok {
+			e.Matched = false
+			e.ExceptTable, e.Except, e.ExceptType = table, rule, rtype
+		}
+	}
+	return e
+}
+
+// explainRule 返回第一条命中的规则, 不检查例外规则
+func (dh *Datahub) explainRule(tag string, name string) *Explanation {
+	e := &Explanation{Tag: tag, Query: name}
+	_, e.Cached = dh.matchCache.peek(tag, tag+name)
+
+	if list := dh.getDataTableByTag(datatable.DateTypeDomainlistTable, tag); list != nil {
+		if mtype, rule, ok := list.GetData().(*datatable.DomainData).Lookup(name); ok {
+			return e.set(datatable.DateTypeDomainlistTable, list.Source(), rule, mtype)
+		}
+	}
+	if list := dh.getDataTableByTag(datatable.DateTypeKeywordTable, tag); list != nil {
+		if word, ok := list.GetData().(*datatable.KeywordData).MatchKeyword(name); ok {
+			return e.set(datatable.DateTypeKeywordTable, list.Source(), word, netutils.MatchKeywordType)
+		}
+	}
+	if list := dh.getGeoDomainListByTag(tag); list != nil {
+		if mtype, rule, ok := list.Lookup(name); ok {
+			return e.set(ExplainTableGeosite, dh.geositePath, rule, mtype)
+		}
+	}
+	return e
+}
+
+// ExplainNet 按 MixMatchNet 的顺序解释地址匹配结果, 不计入匹配统计
+func (dh *Datahub) ExplainNet(tag string, ip string) *Explanation {
+	tag = strings.ToUpper(tag)
+	e := &Explanation{Tag: tag, Query: ip}
+	inet, err := netutils.ParseIpNet(ip)
+	if err != nil {
+		return e
+	}
+	_, e.Cached = dh.matchCache.peek(tag, tag+inet.String())
+	e = dh.explainNetRule(e, tag, inet)
+	if !dh.tagActive(tag) {
+		e.Matched, e.Inactive = false, true
+	}
+	return e
+}
+
+// explainNetRule 返回第一条命中的网络规则
+func (dh *Datahub) explainNetRule(e *Explanation, tag string, inet iplib.Net) *Explanation {
+	if list := dh.getDataTableByTag(datatable.DateTypeNetlistTable, tag); list != nil {
+		data := list.GetData().(*datatable.NetlistData)
+		if n := data.FindNet(inet); n != nil {
+			return e.set(datatable.DateTypeNetlistTable, list.Source(), n.String(), netutils.MatchCidrType)
+		}
+		if asn, ok := dh.matchNetlistASN(data, inet); ok {
+			return e.set(datatable.DateTypeNetlistTable, list.Source(), fmt.Sprintf("AS%d", asn), netutils.MatchAsnType)
+		}
+	}
+	if list := dh.getGeoNetListByTag(tag); list != nil {
+		if n := list.FindNet(inet); n != nil {
+			return e.set(ExplainTableGeoip, dh.geoipPath, n.String(), netutils.MatchCidrType)
+		}
+	}
+	if record, network := dh.lookupGeoipMmdb(inet); record != nil && record.Match(tag) {
+		return e.set(ExplainTableGeoipMmdb, dh.geoipMmdb.Path(), network, netutils.MatchCidrType)
+	}
+	return e
+}
+
+func (e *Explanation) set(tableType, source, rule, ruleType string) *Explanation {
+	e.Matched = true
+	e.TableType = tableType
+	e.Source = source
+	e.Rule = rule
+	e.RuleType = ruleType
+	return e
+}
@@ -0,0 +1,118 @@
+package datahub
+
+import (
+	"testing"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+)
+
+func TestDatahub_Explain(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "cn",
+		"cn full www.example.cn\ncn domain example.cn\ncn regex ^cdn[0-9]+\\.")
+	loadTestTable(t, dh, datatable.DateTypeKeywordTable, "cn", "cn baidu")
+	geo := netutils.NewDomainList()
+	geo.Add(netutils.MatchDomainType, "qq.com")
+	dh.geositeDoaminListMap["CN"] = geo
+	dh.geositePath = "geosite.dat"
+
+	tests := []struct {
+		name      string
+		tableType string
+		rule      string
+		ruleType  string
+	}{
+		{"www.example.cn", datatable.DateTypeDomainlistTable, "www.example.cn", netutils.MatchFullType},
+		{"a.b.example.cn", datatable.DateTypeDomainlistTable, "example.cn", netutils.MatchDomainType},
+		{"cdn12.example.com", datatable.DateTypeDomainlistTable, `^cdn[0-9]+\.`, netutils.MatchRegexType},
+		{"www.baidu.com", datatable.DateTypeKeywordTable, "baidu", netutils.MatchKeywordType},
+		{"im.qq.com", ExplainTableGeosite, "qq.com", netutils.MatchDomainType},
+		{"www.google.com", "", "", ""},
+	}
+	for _, tc := range tests {
+		e := dh.Explain("cn", tc.name)
+		if e.Matched != (tc.tableType != "") || e.TableType != tc.tableType || e.Rule != tc.rule || e.RuleType != tc.ruleType {
+			t.Errorf("Explain(%s) = %+v", tc.name, e)
+		}
+		if e.Matched && e.Source == "" {
+			t.Errorf("Explain(%s) source is empty", tc.name)
+		}
+	}
+	if e := dh.Explain("cn", "im.qq.com"); e.Cached || e.Source != "geosite.dat" {
+		t.Errorf("Explain = %+v", e)
+	}
+	dh.MixMatch("cn", "im.qq.com")
+	if e := dh.Explain("cn", "im.qq.com"); !e.Cached {
+		t.Errorf("Explain after MixMatch not cached")
+	}
+}
+
+func TestDatahub_ExplainRegexStats(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "ads", "ads regex ^ads\\.\n@@ads.example.com\nads @@regex ^ads\\.ok\\.")
+	dh.MixMatch("ads", "ads.example.net")
+	for _, name := range []string{"ads.example.net", "ads.example.com", "ads.ok.com", "www.example.net"} {
+		dh.Explain("ads", name)
+	}
+	if st := dh.RegexStats("ads"); len(st) != 1 || st[0].Value != 1 {
+		t.Errorf("Explain should not change RegexStats, got %v", st)
+	}
+}
+
+func TestDatahub_ExplainNet(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "lan", "lan 10.0.0.0/8\nlan 2001:db8::/32")
+	e := dh.ExplainNet("lan", "2001:db8::1")
+	if !e.Matched || e.Rule != "2001:db8::/32" || e.RuleType != netutils.MatchCidrType || e.TableType != datatable.DateTypeNetlistTable {
+		t.Errorf("ExplainNet = %+v", e)
+	}
+	if e := dh.ExplainNet("lan", "192.168.1.1"); e.Matched {
+		t.Errorf("ExplainNet = %+v", e)
+	}
+	if e := dh.ExplainNet("lan", "bad ip"); e.Matched {
+		t.Errorf("ExplainNet = %+v", e)
+	}
+}
+
+func TestDatahub_ExplainException(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "ads",
+		"ads domain example.com\n@@www.example.com\nads except cdn.example.com\nads @@regex ^img[0-9]+\\.\n")
+	loadTestTable(t, dh, datatable.DateTypeKeywordTable, "ads", "ads track\n@@trackless\nads except safe\n")
+	geo := netutils.NewDomainList()
+	geo.Add(netutils.MatchDomainType, "doubleclick.net")
+	dh.geositeDoaminListMap["ADS"] = geo
+
+	tests := []struct {
+		name        string
+		match       bool
+		exceptTable string
+		except      string
+		exceptType  string
+	}{
+		{"ad.example.com", true, "", "", ""},
+		{"a.www.example.com", false, datatable.DateTypeDomainlistTable, "www.example.com", netutils.MatchDomainType},
+		{"cdn.example.com", false, datatable.DateTypeDomainlistTable, "cdn.example.com", netutils.MatchDomainType},
+		{"img1.example.com", false, datatable.DateTypeDomainlistTable, `^img[0-9]+\.`, netutils.MatchRegexType},
+		{"tracker.net", true, "", "", ""},
+		{"trackless.net", false, datatable.DateTypeKeywordTable, "trackless", netutils.MatchKeywordType},
+		{"safe.doubleclick.net", false, datatable.DateTypeKeywordTable, "safe", netutils.MatchKeywordType},
+		{"ad.doubleclick.net", true, "", "", ""},
+	}
+	for _, tc := range tests {
+		if got := dh.MixMatch("ads", tc.name); got != tc.match {
+			t.Errorf("MixMatch(%s) = %v, want %v", tc.name, got, tc.match)
+		}
+		e := dh.Explain("ads", tc.name)
+		if e.Matched != tc.match || e.ExceptTable != tc.exceptTable || e.Except != tc.except || e.ExceptType != tc.exceptType {
+			t.Errorf("Explain(%s) = %+v", tc.name, e)
+		}
+		if !tc.match && e.Rule == "" {
+			t.Errorf("Explain(%s) overridden rule is empty", tc.name)
+		}
+	}
+	if _, ok := dh.LookupKeyword("ads", "trackless.net"); ok {
+		t.Error("LookupKeyword should honour keyword exceptions")
+	}
+}
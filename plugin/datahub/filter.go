@@ -0,0 +1,112 @@
+package datahub
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+	"github.com/ca17/datahub/plugin/pkg/tagexpr"
+	"github.com/miekg/dns"
+)
+
+const (
+	FilterActionDrop     = "drop"
+	FilterActionServfail = "servfail"
+	FilterActionNxdomain = "nxdomain"
+
+	filterStatPrefix = "filtered:"
+)
+
+// answerFilter 应答 IP 过滤, 应答地址命中网络标签或标签表达式时移除记录或拒绝整个应答
+type answerFilter struct {
+	tags   []string
+	expr   *tagexpr.Expr // 配置为表达式时使用
+	action string
+}
+
+// newAnswerFilter 解析配置, 格式为 `filter_answers tag,tag...|expr [drop|servfail|nxdomain]`
+func newAnswerFilter(tags string, args []string) (*answerFilter, error) {
+	f := &answerFilter{action: FilterActionDrop}
+	if tagexpr.IsExpr(tags) {
+		expr, err := tagexpr.Parse(tags)
+		if err != nil {
+			return nil, err
+		}
+		f.expr = expr
+	} else {
+		f.tags = strings.Split(tags, ",")
+	}
+	if len(args) > 1 {
+		return nil, fmt.Errorf("filter_answers too many args")
+	}
+	if len(args) == 1 {
+		f.action = strings.ToLower(args[0])
+	}
+	switch f.action {
+	case FilterActionDrop, FilterActionServfail, FilterActionNxdomain:
+	default:
+		return nil, fmt.Errorf("unsupported filter_answers action %s", args[0])
+	}
+	return f, nil
+}
+
+func (f *answerFilter) String() string {
+	if f.expr != nil {
+		return fmt.Sprintf("%s:%s", f.expr, f.action)
+	}
+	return fmt.Sprintf("%s:%s", strings.Join(f.tags, ","), f.action)
+}
+
+// matchFilterTag 返回应答 IP 命中的第一个过滤标签, 配置为表达式时返回表达式文本.
+// 匹配不计入标签本身的网络统计, 过滤数由 filterAnswers 单独统计
+func (dh *Datahub) matchFilterTag(rr dns.RR) string {
+	ip := answerIP(rr)
+	if ip == nil {
+		return ""
+	}
+	inet := netutils.HostNet(ip)
+	if expr := dh.answerFilter.expr; expr != nil {
+		if dh.matchTagExprNet(expr, inet, dh.mixMatchNet) {
+			return expr.String()
+		}
+		return ""
+	}
+	for _, tag := range dh.answerFilter.tags {
+		if tag = strings.ToUpper(tag); dh.mixMatchNet(tag, inet) {
+			return tag
+		}
+	}
+	return ""
+}
+
+// filterAnswers 过滤应答中命中标签的 A/AAAA 记录, 过滤数计入网络标签统计
+func (dh *Datahub) filterAnswers(res *dns.Msg) *dns.Msg {
+	if res == nil {
+		return res
+	}
+	answer := make([]dns.RR, 0, len(res.Answer))
+	filtered := 0
+	for _, rr := range res.Answer {
+		if tag := dh.matchFilterTag(rr); tag != "" {
+			dh.networkMatchStat.Incr(filterStatPrefix+tag, 1)
+			filtered++
+			continue
+		}
+		answer = append(answer, rr)
+	}
+	if filtered == 0 {
+		return res
+	}
+	switch dh.answerFilter.action {
+	case FilterActionServfail, FilterActionNxdomain:
+		m := new(dns.Msg)
+		m.SetRcode(res, dns.RcodeServerFailure)
+		if dh.answerFilter.action == FilterActionNxdomain {
+			m.Rcode = dns.RcodeNameError
+			dh.metricsStat.Incr(MetricsStatNxdomain, 1)
+		}
+		return m
+	}
+	res.Answer = answer
+	return res
+}
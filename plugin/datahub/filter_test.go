@@ -0,0 +1,97 @@
+package datahub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestDatahub_ServeDNSFilterAnswers(t *testing.T) {
+	tests := []struct {
+		action  string
+		rcode   int
+		answers int
+	}{
+		{FilterActionDrop, dns.RcodeSuccess, 2},
+		{FilterActionServfail, dns.RcodeServerFailure, 0},
+		{FilterActionNxdomain, dns.RcodeNameError, 0},
+	}
+	for _, tc := range tests {
+		dh := NewDatahub()
+		loadTestTable(t, dh, datatable.DateTypeNetlistTable, "private", "private 10.0.0.0/8\nprivate 192.168.0.0/16\n")
+		f, err := newAnswerFilter("private", []string{tc.action})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dh.answerFilter = f
+		dh.Next = test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Answer = []dns.RR{
+				test.CNAME("rebind.example.com. 60 IN CNAME a.example.com."),
+				test.A("a.example.com. 60 IN A 192.168.1.1"),
+				test.A("a.example.com. 60 IN A 93.184.216.34"),
+			}
+			_ = w.WriteMsg(m)
+			return dns.RcodeSuccess, nil
+		})
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		m := new(dns.Msg)
+		m.SetQuestion("rebind.example.com.", dns.TypeA)
+		if _, err := dh.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Msg.Rcode != tc.rcode || len(rec.Msg.Answer) != tc.answers {
+			t.Errorf("%s: rcode %d answers %v, want %d %d", tc.action, rec.Msg.Rcode, rec.Msg.Answer, tc.rcode, tc.answers)
+		}
+		found := false
+		for _, c := range dh.MatcherStats("network") {
+			if c.Name == filterStatPrefix+"PRIVATE" && c.Value == 1 {
+				found = true
+			}
+			if c.Name == "PRIVATE" && c.Value != 0 {
+				t.Errorf("%s: filtering counted as network match %v", tc.action, c)
+			}
+		}
+		if !found {
+			t.Errorf("%s: filtered stat not reported %v", tc.action, dh.MatcherStats("network"))
+		}
+	}
+}
+
+func Test_newAnswerFilter(t *testing.T) {
+	if f, err := newAnswerFilter("private", nil); err != nil || f.action != FilterActionDrop {
+		t.Errorf("filter_answers default action %v %v", f, err)
+	}
+	if _, err := newAnswerFilter("private", []string{"refused"}); err == nil {
+		t.Error("expected error for unsupported action")
+	}
+}
+
+func TestDatahub_FilterAnswersExpr(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "private", "private 10.0.0.0/8\n")
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "office", "office 10.1.0.0/16\n")
+	f, err := newAnswerFilter("private & !office", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dh.answerFilter = f
+	res := new(dns.Msg)
+	res.Answer = []dns.RR{
+		test.A("example.com. 60 IN A 10.1.0.1"),
+		test.A("example.com. 60 IN A 10.2.0.1"),
+	}
+	res = dh.filterAnswers(res)
+	if len(res.Answer) != 1 || res.Answer[0].(*dns.A).A.String() != "10.1.0.1" {
+		t.Errorf("filter expression answers %v", res.Answer)
+	}
+	if v := dh.networkMatchStat.GetValue(filterStatPrefix + "PRIVATE & !OFFICE"); v != 1 {
+		t.Errorf("filter expression stat %d, want 1", v)
+	}
+}
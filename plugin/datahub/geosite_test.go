@@ -0,0 +1,118 @@
+package datahub
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+	"github.com/ca17/datahub/plugin/pkg/v2data"
+	"github.com/golang/protobuf/proto"
+)
+
+// writeTestGeosite 生成测试用 geosite.dat
+func writeTestGeosite(t *testing.T, sites ...*v2data.GeoSite) string {
+	bs, err := proto.Marshal(&v2data.GeoSiteList{Entry: sites})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(t.TempDir(), "geosite.dat")
+	if err := os.WriteFile(fname, bs, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+func geoDomain(dtype v2data.Domain_Type, value string, attrs ...string) *v2data.Domain {
+	d := &v2data.Domain{Type: dtype, Value: value}
+	for _, a := range attrs {
+		d.Attribute = append(d.Attribute, &v2data.Domain_Attribute{
+			Key: a, TypedValue: &v2data.Domain_Attribute_BoolValue{BoolValue: true},
+		})
+	}
+	return d
+}
+
+func TestDatahub_GeositeAttrSelector(t *testing.T) {
+	dh := NewDatahub()
+	dh.geositePath = writeTestGeosite(t, &v2data.GeoSite{
+		CountryCode: "GEOLOCATION-CN",
+		Domain: []*v2data.Domain{
+			geoDomain(v2data.Domain_Domain, "baidu.com", "cn"),
+			geoDomain(v2data.Domain_Domain, "apple.com"),
+			geoDomain(v2data.Domain_Domain, "doubleclick.cn", "cn", "ads"),
+		},
+	})
+	tags := []string{"geolocation-cn", "geolocation-cn@cn", "geolocation-cn@!cn", "geolocation-cn@cn@!ads", "missing@cn"}
+	if err := dh.reloadGeositeDmoainListByTag(tags, false); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		tag  string
+		name string
+		want bool
+	}{
+		{"geolocation-cn", "www.apple.com", true},
+		{"geolocation-cn", "www.baidu.com", true},
+		{"geolocation-cn@cn", "www.baidu.com", true},
+		{"geolocation-cn@cn", "www.apple.com", false},
+		{"geolocation-cn@!cn", "www.apple.com", true},
+		{"geolocation-cn@!cn", "www.baidu.com", false},
+		{"geolocation-cn@cn@!ads", "doubleclick.cn", false},
+		{"geolocation-cn@cn@!ads", "baidu.com", true},
+		{"missing@cn", "baidu.com", false},
+	}
+	for _, tc := range tests {
+		if got := dh.MixMatch(tc.tag, tc.name); got != tc.want {
+			t.Errorf("MixMatch(%s, %s) = %v, want %v", tc.tag, tc.name, got, tc.want)
+		}
+	}
+	if dh.getGeoDomainListByTag("MISSING@CN") != nil {
+		t.Errorf("missing category loaded")
+	}
+}
+
+func TestDatahub_GeositeDomainTypes(t *testing.T) {
+	dh := NewDatahub()
+	dh.geositePath = writeTestGeosite(t, &v2data.GeoSite{
+		CountryCode: "TEST",
+		Domain: []*v2data.Domain{
+			geoDomain(v2data.Domain_Full, "full.example.com"),
+			geoDomain(v2data.Domain_Domain, "suffix.com"),
+			geoDomain(v2data.Domain_Plain, "keyword"),
+			geoDomain(v2data.Domain_Regex, `^re[0-9]+\.net$`),
+		},
+	})
+	if err := dh.reloadGeositeDmoainListByTag([]string{"test"}, false); err != nil {
+		t.Fatal(err)
+	}
+	// 与 v2ray/xray 路由规则语义一致
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"full.example.com", true},
+		{"www.full.example.com", false},
+		{"example.com", false},
+		{"suffix.com", true},
+		{"a.b.suffix.com", true},
+		{"notsuffix.com", false},
+		{"a-keyword-b.org", true},
+		{"keyword", true},
+		{"keywor.d", false},
+		{"re12.net", true},
+		{"re12.net.cn", false},
+	}
+	for _, tc := range tests {
+		if got := dh.MixMatch("test", tc.name); got != tc.want {
+			t.Errorf("MixMatch(%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	if !dh.MatchGeosite(netutils.MatchKeywordType, "test", "www.keyword.cn") ||
+		dh.MatchGeosite(netutils.MatchDomainType, "test", "full.example.com") {
+		t.Errorf("MatchGeosite type error")
+	}
+	if e := dh.Explain("test", "my.keyword.io"); e.RuleType != netutils.MatchKeywordType || e.Rule != "keyword" {
+		t.Errorf("Explain = %+v", e)
+	}
+}
@@ -0,0 +1,209 @@
+package datahub
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ca17/datahub/plugin/pkg/stats"
+)
+
+const (
+	GroupMatchNetlist = "netlist"
+	GroupMatchGeoip   = "geoip"
+
+	groupTagSep = "/"
+)
+
+type groupMatcher struct {
+	kind string
+	tag  string
+}
+
+// clientGroup 客户端分组, 客户端 IP 命中任一网络标签即属于该分组
+type clientGroup struct {
+	name       string
+	matchers   []groupMatcher
+	clientStat *stats.CounterStat // 分组客户端统计
+	matchStat  *stats.CounterStat // 分组策略, 路由命中统计
+}
+
+// newClientGroup 解析分组配置, 格式为 `client_group name netlist:tag|geoip:tag...`
+func newClientGroup(name string, specs []string) (*clientGroup, error) {
+	if name == "" || strings.Contains(name, groupTagSep) {
+		return nil, fmt.Errorf("client_group name %s error", name)
+	}
+	g := &clientGroup{
+		name:       strings.ToUpper(name),
+		clientStat: stats.NewCounterStat(),
+		matchStat:  stats.NewCounterStat(),
+	}
+	for _, spec := range specs {
+		attrs := strings.SplitN(spec, ":", 2)
+		if len(attrs) != 2 || attrs[1] == "" {
+			return nil, fmt.Errorf("client_group matcher %s format is kind:tag", spec)
+		}
+		switch attrs[0] {
+		case GroupMatchNetlist, GroupMatchGeoip:
+			g.matchers = append(g.matchers, groupMatcher{kind: attrs[0], tag: strings.ToUpper(attrs[1])})
+		default:
+			return nil, fmt.Errorf("unsupported client_group matcher %s", attrs[0])
+		}
+	}
+	if len(g.matchers) == 0 {
+		return nil, fmt.Errorf("client_group %s has no matcher", name)
+	}
+	return g, nil
+}
+
+func (g *clientGroup) String() string {
+	var specs []string
+	for _, m := range g.matchers {
+		specs = append(specs, m.kind+":"+m.tag)
+	}
+	return fmt.Sprintf("%s %s", g.name, strings.Join(specs, " "))
+}
+
+// groupTag 返回分组数据表的存储标签, 全局数据表 group 为空
+func groupTag(group, tag string) string {
+	if group == "" {
+		return strings.ToUpper(tag)
+	}
+	return strings.ToUpper(group + groupTagSep + tag)
+}
+
+// splitGroupArgs 拆分指令末尾的 `group name` 参数
+func splitGroupArgs(args []string) ([]string, string) {
+	if n := len(args); n >= 2 && args[n-2] == "group" {
+		return args[:n-2], strings.ToUpper(args[n-1])
+	}
+	return args, ""
+}
+
+// getClientGroup 按名称查询客户端分组
+func (dh *Datahub) getClientGroup(name string) *clientGroup {
+	for _, g := range dh.groups {
+		if g.name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// matchClientGroup 按配置顺序匹配客户端分组, 未命中返回 nil
+func (dh *Datahub) matchClientGroup(client string) *clientGroup {
+	if len(dh.groups) == 0 {
+		return nil
+	}
+	ip := net.ParseIP(client)
+	for _, g := range dh.groups {
+		for _, m := range g.matchers {
+			switch m.kind {
+			case GroupMatchNetlist:
+				if dh.MatchNetByStr(m.tag, client) {
+					return g
+				}
+			case GroupMatchGeoip:
+				if ip != nil && dh.MatchGeoip(m.tag, ip) {
+					return g
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasGroupTable 判断分组是否存在该标签的数据表
+func (dh *Datahub) hasGroupTable(key string) bool {
+	return dh.domainTableMap.Has(key) || dh.keywordTableMap.Has(key) ||
+		dh.netlistTableMap.Has(key) || dh.ecsTableMap.Has(key) || dh.hostsTableMap.Has(key)
+}
+
+// resolveGroupTag 分组内存在该标签的数据表时使用分组数据表, 否则使用全局数据表
+func (dh *Datahub) resolveGroupTag(group string, tag string) string {
+	if group != "" {
+		if key := groupTag(group, tag); dh.hasGroupTable(key) {
+			return key
+		}
+	}
+	return strings.ToUpper(tag)
+}
+
+// resolveGroupTags 批量解析分组标签
+func (dh *Datahub) resolveGroupTags(group string, tags []string) []string {
+	if group == "" {
+		return tags
+	}
+	result := make([]string, len(tags))
+	for i, tag := range tags {
+		result[i] = dh.resolveGroupTag(group, tag)
+	}
+	return result
+}
+
+// groupKeys 返回分组可见的标签, 包括全局标签与分组内标签
+func groupKeys(group string, keys []string) []string {
+	var result []string
+	for _, k := range keys {
+		i := strings.Index(k, groupTagSep)
+		switch {
+		case i < 0:
+			result = append(result, k)
+		case group != "" && k[:i] == group:
+			result = append(result, k[i+1:])
+		}
+	}
+	return sortedKeys(result)
+}
+
+// MixMatchGroupTags 按客户端分组混合模式匹配域名
+func (dh *Datahub) MixMatchGroupTags(group string, tags []string, name string, reverse bool) bool {
+	return dh.MixMatchTags(dh.resolveGroupTags(strings.ToUpper(group), tags), name, reverse)
+}
+
+// incrGroupStat 递增分组命中统计
+func (dh *Datahub) incrGroupStat(group string, name string) {
+	if g := dh.getClientGroup(group); g != nil {
+		g.matchStat.Incr(name, 1)
+	}
+}
+
+// GroupStat 客户端分组统计
+type GroupStat struct {
+	Group    string          `json:"group"`
+	Queries  int64           `json:"queries"`
+	Clients  []stats.Counter `json:"clients"`
+	Matchers []stats.Counter `json:"matchers"`
+}
+
+// GroupStat 查询分组的查询数, 客户端与策略, 路由命中统计, 分组不存在时返回 nil
+func (dh *Datahub) GroupStat(group string) *GroupStat {
+	g := dh.getClientGroup(strings.ToUpper(group))
+	if g == nil {
+		return nil
+	}
+	return &GroupStat{
+		Group:    g.name,
+		Queries:  dh.groupQueryStat.GetValue(g.name),
+		Clients:  g.clientStat.Values(),
+		Matchers: g.matchStat.Values(),
+	}
+}
+
+// GroupStats 查询分组统计, classify 为 client 或 matcher
+func (dh *Datahub) GroupStats(group string, classify string) []stats.Counter {
+	g := dh.getClientGroup(strings.ToUpper(group))
+	if g == nil {
+		return []stats.Counter{}
+	}
+	switch classify {
+	case "client":
+		return g.clientStat.Values()
+	case "matcher":
+		return g.matchStat.Values()
+	default:
+		return []stats.Counter{
+			*stats.NewCounter("unknow", 0),
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package datahub
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/ca17/datahub/plugin/pkg/stats"
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/valyala/fasthttp"
+)
+
+func TestDatahub_ServeDNSClientGroup(t *testing.T) {
+	dh := NewDatahub()
+	dh.Next = test.NextHandler(dns.RcodeSuccess, nil)
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "office", "office 10.240.0.0/16\n")
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "guest", "guest 192.168.0.0/16\n")
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "ads", "ads domain doubleclick.net\n")
+	for _, spec := range [][]string{{"office", "netlist:office"}, {"guest", "netlist:guest"}} {
+		g, err := newClientGroup(spec[0], spec[1:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		dh.groups = append(dh.groups, g)
+	}
+	// office 分组使用自己的 ads 表
+	fname, rm, err := test.TempFile(t.TempDir(), "ads domain example.org\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+	dh.parseGroupDataTableByTag("OFFICE", datatable.DateTypeDomainlistTable, []string{"ads"}, fname)
+
+	global, _ := newPolicy("ads", PolicyActionNxdomain, nil)
+	guest, _ := newPolicy("social", PolicyActionRefused, nil)
+	guest.group = "GUEST"
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "social", "social domain facebook.com\n")
+	dh.policies = []*policy{global, guest}
+
+	tests := []struct {
+		client string
+		qname  string
+		rcode  int
+	}{
+		{"10.240.0.1", "www.example.org.", dns.RcodeNameError},
+		{"10.240.0.1", "www.doubleclick.net.", -1},
+		{"10.240.0.1", "www.facebook.com.", -1},
+		{"192.168.1.1", "www.doubleclick.net.", dns.RcodeNameError},
+		{"192.168.1.1", "www.facebook.com.", dns.RcodeRefused},
+		{"172.16.0.1", "www.facebook.com.", -1},
+	}
+	for _, tc := range tests {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: tc.client})
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeA)
+		if _, err := dh.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case tc.rcode < 0 && rec.Msg != nil:
+			t.Errorf("%s %s: unexpected answer %v", tc.client, tc.qname, rec.Msg)
+		case tc.rcode >= 0 && (rec.Msg == nil || rec.Msg.Rcode != tc.rcode):
+			t.Errorf("%s %s: answer %v, want rcode %d", tc.client, tc.qname, rec.Msg, tc.rcode)
+		}
+	}
+
+	if v := dh.groupQueryStat.GetValue("OFFICE"); v != 3 {
+		t.Errorf("group query stat OFFICE %d, want 3", v)
+	}
+	if c := dh.GroupStats("guest", "client"); len(c) != 1 || c[0].Value != 2 {
+		t.Errorf("group client stat GUEST %v", c)
+	}
+	if c := dh.GroupStats("guest", "matcher"); len(c) != 2 {
+		t.Errorf("group matcher stat GUEST %v", c)
+	}
+
+	srv := newPubServer(dh)
+	srv.routes()
+	get := func(uri string) (int, []byte) {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.SetMethod(fasthttp.MethodGet)
+		ctx.Request.SetRequestURI(uri)
+		srv.router.HandleRequest(ctx)
+		return ctx.Response.StatusCode(), ctx.Response.Body()
+	}
+	code, body := get("/group/stats/guest")
+	var st GroupStat
+	if err := json.Unmarshal(body, &st); code != fasthttp.StatusOK || err != nil {
+		t.Fatalf("/group/stats/guest %d %s", code, body)
+	}
+	if st.Group != "GUEST" || st.Queries != 2 || len(st.Clients) != 1 || len(st.Matchers) != 2 {
+		t.Errorf("/group/stats/guest %+v", st)
+	}
+	code, body = get("/group/stats")
+	var all []stats.Counter
+	if err := json.Unmarshal(body, &all); code != fasthttp.StatusOK || err != nil || len(all) != 2 {
+		t.Errorf("/group/stats %d %s", code, body)
+	}
+	if code, _ := get("/group/stats/lab"); code != fasthttp.StatusNotFound {
+		t.Errorf("/group/stats/lab status %d, want 404", code)
+	}
+}
+
+func Test_parseConfigClientGroup(t *testing.T) {
+	c := caddy.NewTestController("dns", `datahub {
+        client_group office netlist:office
+        client_group guest geoip:private
+        netlist_table office 10.0.0.0/8
+        policy ads nxdomain group guest
+    }`)
+	dh, err := parseConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dh.groups) != 2 || dh.policies[0].group != "GUEST" {
+		t.Fatalf("client_group parse error %v %v", dh.groups, dh.policies)
+	}
+
+	c = caddy.NewTestController("dns", `datahub {
+        policy ads nxdomain group lab
+    }`)
+	if _, err := parseConfig(c); err == nil {
+		t.Fatal("expected error for undefined client_group")
+	}
+}
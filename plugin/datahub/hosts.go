@@ -0,0 +1,67 @@
+package datahub
+
+import (
+	"strings"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// lookupHosts 按标签顺序查询本地应答表, 分组应答表优先, 第一个包含该域名的表生效
+func (dh *Datahub) lookupHosts(group string, name string, qtype uint16) ([]dns.RR, bool) {
+	order, _ := dh.hostsOrder.Load().(map[string][]string)
+	if len(order) == 0 {
+		return nil, false
+	}
+	keys, ok := order[group]
+	if !ok {
+		keys = order[""]
+	}
+	for _, key := range keys {
+		if table := dh.getDataTableByTag(datatable.DateTypeHostsTable, key); table != nil {
+			if answer, found := table.GetData().(*datatable.HostsData).Lookup(name, qtype); found {
+				return answer, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// updateHostsOrder 在本地应答表加载后计算各分组的查询顺序, 查询时只读.
+// 没有分组应答表的客户端分组使用全局顺序
+func (dh *Datahub) updateHostsOrder() {
+	keys := dh.hostsTableMap.Keys()
+	groups := map[string]bool{"": true}
+	for _, k := range keys {
+		if i := strings.Index(k, groupTagSep); i >= 0 {
+			groups[k[:i]] = true
+		}
+	}
+	order := make(map[string][]string, len(groups))
+	for group := range groups {
+		tags := groupKeys(group, keys)
+		resolved := make([]string, len(tags))
+		for i, tag := range tags {
+			resolved[i] = tag
+			if key := groupTag(group, tag); group != "" && dh.hostsTableMap.Has(key) {
+				resolved[i] = key
+			}
+		}
+		order[group] = resolved
+	}
+	dh.hostsOrder.Store(order)
+}
+
+// serveHosts 以权威应答返回本地记录, 无对应类型记录时返回 NODATA
+func (dh *Datahub) serveHosts(answer []dns.RR, state *request.Request) (int, error) {
+	dh.metricsStat.Incr(MetricsStatHostsHits, 1)
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Authoritative = true
+	m.Answer = answer
+	if err := state.W.WriteMsg(m); err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	return dns.RcodeSuccess, nil
+}
@@ -0,0 +1,113 @@
+package datahub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+const testHosts = `# hosts
+10.0.0.1 printer.lan nas.lan
+2001:db8::1 nas.lan
+local www.example.lan CNAME web.example.lan
+web.example.lan A 10.0.0.2 300
+*.dev.lan A 10.0.0.3
+info.lan TXT "hello world"
+`
+
+func TestDatahub_ServeDNSHosts(t *testing.T) {
+	dh := NewDatahub()
+	dh.Next = test.NextHandler(dns.RcodeSuccess, nil)
+	loadTestTable(t, dh, datatable.DateTypeHostsTable, "local", testHosts)
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		want  []string
+	}{
+		{"printer.lan.", dns.TypeA, []string{"printer.lan.\t3600\tIN\tA\t10.0.0.1"}},
+		{"NAS.lan.", dns.TypeAAAA, []string{"nas.lan.\t3600\tIN\tAAAA\t2001:db8::1"}},
+		{"printer.lan.", dns.TypeAAAA, nil},
+		{"www.example.lan.", dns.TypeA, []string{
+			"www.example.lan.\t3600\tIN\tCNAME\tweb.example.lan.",
+			"web.example.lan.\t300\tIN\tA\t10.0.0.2",
+		}},
+		{"a.b.dev.lan.", dns.TypeA, []string{"a.b.dev.lan.\t3600\tIN\tA\t10.0.0.3"}},
+		{"info.lan.", dns.TypeTXT, []string{"info.lan.\t3600\tIN\tTXT\t\"hello world\""}},
+	}
+	for _, tc := range tests {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		if _, err := dh.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Msg == nil || !rec.Msg.Authoritative {
+			t.Fatalf("%s: no authoritative answer %v", tc.qname, rec.Msg)
+		}
+		if len(rec.Msg.Answer) != len(tc.want) {
+			t.Fatalf("%s: answers %v, want %v", tc.qname, rec.Msg.Answer, tc.want)
+		}
+		for i, rr := range rec.Msg.Answer {
+			if rr.String() != tc.want[i] {
+				t.Errorf("%s: answer %q, want %q", tc.qname, rr.String(), tc.want[i])
+			}
+		}
+	}
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	m := new(dns.Msg)
+	m.SetQuestion("dev.lan.", dns.TypeA)
+	if _, err := dh.ServeDNS(context.Background(), rec, m); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Msg != nil {
+		t.Errorf("dev.lan: wildcard should not match parent, got %v", rec.Msg)
+	}
+}
+
+func TestDatahub_HostsInline(t *testing.T) {
+	dh := NewDatahub()
+	dh.parseDataTableByTag(datatable.DateTypeHostsTable, []string{"office"}, "OFFICE 10.0.0.1 printer.lan")
+	answer, found := dh.lookupHosts("", "printer.lan", dns.TypeA)
+	if !found || len(answer) != 1 {
+		t.Fatalf("inline hosts lookup %v %v", answer, found)
+	}
+}
+
+func TestDatahub_LookupHostsGroup(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeHostsTable, "local", "10.0.0.1 printer.lan\n10.0.0.9 nas.lan\n")
+	fname, rm, err := test.TempFile(t.TempDir(), "10.1.0.1 printer.lan\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+	dh.parseGroupDataTableByTag("OFFICE", datatable.DateTypeHostsTable, []string{"local"}, fname)
+
+	tests := []struct {
+		group, name, want string
+	}{
+		{"", "printer.lan", "10.0.0.1"},
+		{"OFFICE", "printer.lan", "10.1.0.1"},
+		{"", "nas.lan", "10.0.0.9"},
+		{"GUEST", "printer.lan", "10.0.0.1"},
+	}
+	for _, tc := range tests {
+		answer, found := dh.lookupHosts(tc.group, tc.name, dns.TypeA)
+		if !found || len(answer) != 1 || answer[0].(*dns.A).A.String() != tc.want {
+			t.Errorf("lookupHosts(%s, %s) = %v, want %s", tc.group, tc.name, answer, tc.want)
+		}
+	}
+	// 分组应答表替代同名的全局应答表
+	if _, found := dh.lookupHosts("OFFICE", "nas.lan", dns.TypeA); found {
+		t.Error("group hosts table should replace the global table")
+	}
+	if _, found := dh.lookupHosts("", "www.example.com", dns.TypeA); found {
+		t.Error("unknown name should not be found")
+	}
+}
@@ -0,0 +1,124 @@
+package datahub
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/allegro/bigcache"
+	"github.com/ca17/datahub/plugin/pkg/stats"
+	"github.com/orcaman/concurrent-map"
+)
+
+const (
+	MatchCacheHits         = "hits"
+	MatchCacheNegativeHits = "negative_hits"
+	MatchCacheMisses       = "misses"
+	MatchCacheStale        = "stale"
+	MatchCacheInvalidated  = "invalidated"
+	MatchCacheEntries      = "entries"
+
+	defaultMatchCacheTTL = 300 * time.Second
+
+	matchCacheGlobal = "" // 全局代际, 任一标签失效时递增, 用于涉及多个标签的表达式缓存
+	matchCacheGenLen = 8
+)
+
+// matchCache 带代际标记的匹配缓存.
+// 每个标签维护一个代际, 数据表重新加载时递增; 缓存值记录求值前的代际, 代际不一致的结果视为过期.
+// 未命中的结果同样缓存, 值为空匹配器
+type matchCache struct {
+	cache *bigcache.BigCache // nil 表示禁用缓存
+	gens  cmap.ConcurrentMap // tag -> *uint64
+	epoch uint64             // 全部标签共享的代际, 标签集合不固定的数据源(如 mmdb)变更时递增
+	stat  *stats.CounterStat
+}
+
+// newMatchCache 创建匹配缓存, ttl 小于等于 0 时禁用, maxSize 为最大内存(MB), 0 表示不限制.
+// 缓存创建失败时返回禁用缓存的实例及错误
+func newMatchCache(ttl time.Duration, maxSize int) (*matchCache, error) {
+	c := &matchCache{gens: cmap.New(), stat: stats.NewCounterStat()}
+	if ttl > 0 {
+		config := bigcache.DefaultConfig(ttl)
+		config.HardMaxCacheSize = maxSize
+		cache, err := bigcache.NewBigCache(config)
+		if err != nil {
+			return c, fmt.Errorf("match_cache create error %s", err.Error())
+		}
+		c.cache = cache
+	}
+	return c, nil
+}
+
+func (c *matchCache) generation(tag string) uint64 {
+	gen := atomic.LoadUint64(&c.epoch)
+	if v, ok := c.gens.Get(tag); ok {
+		gen += atomic.LoadUint64(v.(*uint64))
+	}
+	return gen
+}
+
+// invalidate 递增标签代际及全局代际, 使已缓存的结果失效
+func (c *matchCache) invalidate(tag string) {
+	for _, t := range []string{tag, matchCacheGlobal} {
+		c.gens.SetIfAbsent(t, new(uint64))
+		v, _ := c.gens.Get(t)
+		atomic.AddUint64(v.(*uint64), 1)
+	}
+	c.stat.Incr(MatchCacheInvalidated, 1)
+}
+
+// invalidateAll 使全部标签的缓存结果失效
+func (c *matchCache) invalidateAll() {
+	atomic.AddUint64(&c.epoch, 1)
+	c.stat.Incr(MatchCacheInvalidated, 1)
+}
+
+// peek 查询缓存, 不计入统计; cached 表示存在当前代际的结果, matcher 为空表示未命中的结果
+func (c *matchCache) peek(tag string, key string) (matcher string, cached bool) {
+	if c.cache == nil {
+		return "", false
+	}
+	bs, err := c.cache.Get(key)
+	if err != nil || len(bs) < matchCacheGenLen ||
+		binary.BigEndian.Uint64(bs) != c.generation(tag) {
+		return "", false
+	}
+	return string(bs[matchCacheGenLen:]), true
+}
+
+// lookup 返回缓存结果, 缓存不存在或已过期时调用 eval 求值并缓存
+func (c *matchCache) lookup(tag string, key string, eval func() string) string {
+	if c.cache == nil {
+		return eval()
+	}
+	gen := c.generation(tag)
+	bs, err := c.cache.Get(key)
+	switch {
+	case err != nil || len(bs) < matchCacheGenLen:
+		c.stat.Incr(MatchCacheMisses, 1)
+	case binary.BigEndian.Uint64(bs) != gen:
+		c.stat.Incr(MatchCacheStale, 1)
+	case len(bs) == matchCacheGenLen:
+		c.stat.Incr(MatchCacheNegativeHits, 1)
+		return ""
+	default:
+		c.stat.Incr(MatchCacheHits, 1)
+		return string(bs[matchCacheGenLen:])
+	}
+	matcher := eval()
+	bs = make([]byte, matchCacheGenLen+len(matcher))
+	binary.BigEndian.PutUint64(bs, gen)
+	copy(bs[matchCacheGenLen:], matcher)
+	_ = c.cache.Set(key, bs)
+	return matcher
+}
+
+// Len 缓存条目数
+func (c *matchCache) Len() int {
+	if c.cache == nil {
+		return 0
+	}
+	return c.cache.Len()
+}
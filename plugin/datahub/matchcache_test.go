@@ -0,0 +1,93 @@
+package datahub
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/coredns/caddy"
+)
+
+func TestDatahub_MatchCacheInvalidate(t *testing.T) {
+	dh := NewDatahub()
+	fname := filepath.Join(t.TempDir(), "ads.txt")
+	if err := os.WriteFile(fname, []byte("ads domain doubleclick.net\nads domain ad.example.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dh.parseDataTableByTag(datatable.DateTypeDomainlistTable, []string{"ads"}, fname)
+
+	for i := 0; i < 2; i++ {
+		if !dh.MixMatch("ads", "ad.example.com") {
+			t.Fatal("ad.example.com should match")
+		}
+		if dh.MixMatch("ads", "www.example.com") {
+			t.Fatal("www.example.com should not match")
+		}
+	}
+	stat := dh.matchCache.stat
+	if stat.GetValue(MatchCacheHits) != 1 || stat.GetValue(MatchCacheNegativeHits) != 1 || stat.GetValue(MatchCacheMisses) != 2 {
+		t.Errorf("cache stats %v", dh.MatchCacheStats())
+	}
+
+	// 重新加载后旧的命中与未命中结果均失效
+	if err := os.WriteFile(fname, []byte("ads domain doubleclick.net\nads full www.example.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(fname, future, future)
+	dh.getDataTableByTag(datatable.DateTypeDomainlistTable, "ads").LoadFromFile()
+	if dh.MixMatch("ads", "ad.example.com") {
+		t.Error("removed entry still matches after reload")
+	}
+	if !dh.MixMatch("ads", "www.example.com") {
+		t.Error("added entry does not match after reload")
+	}
+	if stat.GetValue(MatchCacheStale) != 2 {
+		t.Errorf("cache stale %d, want 2", stat.GetValue(MatchCacheStale))
+	}
+
+	// 表达式缓存使用全局代际
+	expr, _ := CompileTagExpr("!ads")
+	if dh.MatchTagExpr(expr, "www.example.com") {
+		t.Error("expression should not match")
+	}
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "ads", "ads domain doubleclick.net\n")
+	if !dh.MatchTagExpr(expr, "www.example.com") {
+		t.Error("expression cache not invalidated by table reload")
+	}
+}
+
+func TestDatahub_MatchCacheOff(t *testing.T) {
+	c := caddy.NewTestController("dns", `datahub {
+        match_cache off
+    }`)
+	dh, err := parseConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "ads", "ads domain doubleclick.net\n")
+	for i := 0; i < 2; i++ {
+		if !dh.MixMatch("ads", "www.doubleclick.net") {
+			t.Fatal("www.doubleclick.net should match")
+		}
+	}
+	if dh.matchCache.Len() != 0 || dh.matchCache.stat.GetValue(MatchCacheHits) != 0 || dh.matchCache.stat.GetValue(MatchCacheMisses) != 0 {
+		t.Errorf("disabled cache stats %v", dh.MatchCacheStats())
+	}
+
+	for _, conf := range []string{"match_cache 0s", "match_cache 60s -1", "match_cache"} {
+		c := caddy.NewTestController("dns", "datahub {\n"+conf+"\n}")
+		if _, err := parseConfig(c); err == nil {
+			t.Errorf("%s: expected error", conf)
+		}
+	}
+	c = caddy.NewTestController("dns", "datahub {\nmatch_cache 10m 64\n}")
+	if dh, err = parseConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	if dh.matchCache.cache == nil {
+		t.Error("match_cache 10m 64 should enable the cache")
+	}
+}
@@ -0,0 +1,143 @@
+package datahub
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/request"
+)
+
+const (
+	MetadataTags       = "datahub/tags"
+	MetadataClientTags = "datahub/client_tags"
+	MetadataEcs        = "datahub/ecs"
+	MetadataGeo        = "datahub/geo"
+	MetadataGroup      = "datahub/group"
+)
+
+// Metadata 实现 metadata.Provider, 匹配结果在首次读取时计算
+func (dh *Datahub) Metadata(ctx context.Context, state request.Request) context.Context {
+	name := netutils.NormalizeDomain(state.Name())
+	client := state.IP()
+	group := lazyValue(func() string {
+		if g := dh.matchClientGroup(client); g != nil {
+			return g.name
+		}
+		return ""
+	})
+	metadata.SetValueFunc(ctx, MetadataGroup, group)
+	metadata.SetValueFunc(ctx, MetadataTags, lazyValue(func() string {
+		return strings.Join(dh.matchNameTags(group(), name), ",")
+	}))
+	metadata.SetValueFunc(ctx, MetadataClientTags, lazyValue(func() string {
+		return strings.Join(dh.matchClientTags(group(), client), ",")
+	}))
+	metadata.SetValueFunc(ctx, MetadataEcs, lazyValue(func() string {
+		return dh.matchClientEcs(group(), client)
+	}))
+	metadata.SetValueFunc(ctx, MetadataGeo, lazyValue(func() string {
+		return strings.Join(dh.matchClientGeo(client), ",")
+	}))
+	return ctx
+}
+
+// lazyValue 缓存 f 的结果, 同一请求内只计算一次
+func lazyValue(f func() string) metadata.Func {
+	var once sync.Once
+	var value string
+	return func() string {
+		once.Do(func() { value = f() })
+		return value
+	}
+}
+
+// matchNameTags 返回域名命中的域名表, 关键词表与 geosite 标签
+func (dh *Datahub) matchNameTags(group string, name string) []string {
+	var tags []string
+	for _, tag := range dh.nameTags(group) {
+		if dh.MixMatch(dh.resolveGroupTag(group, tag), name) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// matchClientTags 返回客户端 IP 命中的网络地址表标签
+func (dh *Datahub) matchClientTags(group string, client string) []string {
+	var tags []string
+	for _, tag := range groupKeys(group, dh.netlistTableMap.Keys()) {
+		if dh.MatchNetByStr(dh.resolveGroupTag(group, tag), client) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// matchClientGeo 返回客户端 IP 命中的 geoip 标签
+func (dh *Datahub) matchClientGeo(client string) []string {
+	ip := net.ParseIP(client)
+	if ip == nil {
+		return nil
+	}
+	var tags []string
+	for _, tag := range dh.geoipTags() {
+		if dh.MatchGeoip(tag, ip) {
+			tags = append(tags, tag)
+		}
+	}
+	if record, _ := dh.lookupGeoipMmdb(netutils.HostNet(ip)); record != nil {
+		tags = sortedKeys(append(tags, record.Tags()...))
+	}
+	return tags
+}
+
+// matchClientEcs 返回客户端在 ECS 表中匹配的第一个 ECS 地址
+func (dh *Datahub) matchClientEcs(group string, client string) string {
+	for _, tag := range groupKeys(group, dh.ecsTableMap.Keys()) {
+		if ecsip := dh.MatchEcs(dh.resolveGroupTag(group, tag), client); ecsip != nil {
+			return ecsip.String()
+		}
+	}
+	return ""
+}
+
+// nameTags 返回分组可见的域名类标签
+func (dh *Datahub) nameTags(group string) []string {
+	keys := dh.domainTableMap.Keys()
+	keys = append(keys, dh.keywordTableMap.Keys()...)
+	dh.geodlmLock.RLock()
+	for k := range dh.geositeDoaminListMap {
+		keys = append(keys, k)
+	}
+	dh.geodlmLock.RUnlock()
+	return groupKeys(group, keys)
+}
+
+// geoipTags 返回所有已加载的 geoip 标签
+func (dh *Datahub) geoipTags() []string {
+	var keys []string
+	dh.geonlmLock.RLock()
+	for k := range dh.geoipNetListMap {
+		keys = append(keys, k)
+	}
+	dh.geonlmLock.RUnlock()
+	return sortedKeys(keys)
+}
+
+// sortedKeys 去重并排序
+func sortedKeys(keys []string) []string {
+	sort.Strings(keys)
+	var result []string
+	for i, k := range keys {
+		if i > 0 && keys[i-1] == k {
+			continue
+		}
+		result = append(result, k)
+	}
+	return result
+}
@@ -0,0 +1,42 @@
+package datahub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+func TestDatahub_Metadata(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "cn", "cn domain baidu.com\n")
+	loadTestTable(t, dh, datatable.DateTypeKeywordTable, "search", "search baidu\n")
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "ads", "ads domain doubleclick.net\n")
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "office", "office 10.240.0.0/16\n")
+	loadTestTable(t, dh, datatable.DateTypeEcsTable, "global", "global 10.240.0.0/16 114.114.114.114\n")
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.baidu.com.", dns.TypeA)
+	state := request.Request{W: &test.ResponseWriter{}, Req: m}
+	ctx := dh.Metadata(metadata.ContextWithMetadata(context.Background()), state)
+
+	tests := map[string]string{
+		MetadataTags:       "CN,SEARCH",
+		MetadataClientTags: "OFFICE",
+		MetadataEcs:        "114.114.114.114",
+		MetadataGeo:        "",
+	}
+	for label, want := range tests {
+		f := metadata.ValueFunc(ctx, label)
+		if f == nil {
+			t.Fatalf("label %s not set", label)
+		}
+		if got := f(); got != want {
+			t.Errorf("label %s = %q, want %q", label, got, want)
+		}
+	}
+}
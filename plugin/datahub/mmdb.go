@@ -0,0 +1,56 @@
+package datahub
+
+import (
+	"github.com/c-robinson/iplib"
+	"github.com/ca17/datahub/plugin/pkg/mmdb"
+)
+
+const (
+	ExplainTableGeoipMmdb = "geoip_mmdb"
+
+	geoipMmdbReloadCron = "@every 60s"
+)
+
+// lookupGeoipMmdb 查询完整包含网段 inet 的 mmdb 记录, 未配置 geoip_mmdb 或未找到时返回 nil
+func (dh *Datahub) lookupGeoipMmdb(inet iplib.Net) (*mmdb.Record, string) {
+	if dh.geoipMmdb == nil {
+		return nil, ""
+	}
+	record, network := dh.geoipMmdb.LookupNetwork(inet.IP())
+	if record == nil {
+		return nil, ""
+	}
+	ones, bits := network.Mask.Size()
+	inOnes, inBits := inet.Mask().Size()
+	if bits > inBits {
+		// IPv6 数据库中的 IPv4 网段
+		ones -= bits - inBits
+	}
+	if ones > inOnes {
+		return nil, ""
+	}
+	return record, network.String()
+}
+
+// matchGeoipMmdb 按 mmdb 记录匹配 geoip 标签, 标签格式见 mmdb.Record.Match,
+// 不符合 mmdb 标签格式的标签不查询 mmdb
+func (dh *Datahub) matchGeoipMmdb(tag string, inet iplib.Net) bool {
+	if dh.geoipMmdb == nil || !mmdb.IsTag(tag) {
+		return false
+	}
+	record, _ := dh.lookupGeoipMmdb(inet)
+	return record != nil && record.Match(tag)
+}
+
+// reloadGeoipMmdb mmdb 文件变化时重新打开, 并使全部匹配缓存失效
+func (dh *Datahub) reloadGeoipMmdb() {
+	reloaded, err := dh.geoipMmdb.Reload()
+	if err != nil {
+		log.Errorf("reload geoip_mmdb %s", err.Error())
+		return
+	}
+	if reloaded {
+		dh.matchCache.invalidateAll()
+		log.Infof("geoip_mmdb %s reloaded", dh.geoipMmdb.Path())
+	}
+}
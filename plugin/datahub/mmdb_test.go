@@ -0,0 +1,63 @@
+package datahub
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/coredns/caddy"
+)
+
+func TestDatahub_GeoipMmdb(t *testing.T) {
+	bs, err := os.ReadFile("../pkg/mmdb/testdata/GeoLite2-City.mmdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(t.TempDir(), "city.mmdb")
+	if err := os.WriteFile(fname, bs, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := caddy.NewTestController("dns", "datahub {\ngeoip_mmdb "+fname+"\n}")
+	dh, err := parseConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "gb", "gb 81.2.69.0/24\n")
+
+	ip := net.ParseIP("81.2.69.142")
+	if !dh.MatchGeoip("gb", ip) || !dh.MatchGeoip("continent:eu", ip) || dh.MatchGeoip("cn", ip) {
+		t.Error("MatchGeoip mmdb mismatch")
+	}
+	if !dh.MixMatchNetByStr("city:cambridge", "81.2.69.142") || dh.MixMatchNetByStr("continent:eu", "81.2.69.0/24") {
+		t.Error("MixMatchNet mmdb mismatch")
+	}
+	if e := dh.ExplainNet("continent:eu", "81.2.69.142"); !e.Matched || e.TableType != ExplainTableGeoipMmdb {
+		t.Errorf("ExplainNet = %+v", e)
+	}
+	waitTagIndex(t, dh)
+	if tags := dh.TagsOfIP("81.2.69.142"); !reflect.DeepEqual(tags, []string{"CONTINENT:EU", "GB"}) {
+		t.Errorf("TagsOfIP = %v", tags)
+	}
+
+	invalidated := dh.matchCache.stat.GetValue(MatchCacheInvalidated)
+	dh.reloadGeoipMmdb()
+	if dh.matchCache.stat.GetValue(MatchCacheInvalidated) != invalidated {
+		t.Error("unchanged mmdb should not invalidate cache")
+	}
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(fname, future, future)
+	gen := dh.matchCache.generation("GB")
+	dh.reloadGeoipMmdb()
+	if dh.matchCache.generation("GB") == gen {
+		t.Error("mmdb reload should invalidate cache")
+	}
+
+	c = caddy.NewTestController("dns", "datahub {\ngeoip_mmdb "+filepath.Join(t.TempDir(), "missing.mmdb")+"\n}")
+	if _, err := parseConfig(c); err == nil {
+		t.Error("expected error for missing mmdb")
+	}
+}
@@ -0,0 +1,120 @@
+package datahub
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ca17/datahub/plugin/pkg/tagexpr"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+const (
+	PolicyActionBlock    = "block"
+	PolicyActionNxdomain = "nxdomain"
+	PolicyActionRefused  = "refused"
+	PolicyActionSinkhole = "sinkhole"
+
+	policyAnswerTTL = 60
+)
+
+// policy 标签策略, 查询域名命中标签表达式时由 Datahub 直接应答
+type policy struct {
+	tags      string
+	expr      *tagexpr.Expr
+	group     string
+	action    string
+	sinkhole4 net.IP
+	sinkhole6 net.IP
+}
+
+// newPolicy 解析策略配置, 格式为 `policy tag,tag...|expr block|nxdomain|refused|sinkhole [ip...] [group name]`
+func newPolicy(tags string, action string, args []string) (*policy, error) {
+	expr, err := tagexpr.Parse(tags)
+	if err != nil {
+		return nil, err
+	}
+	p := &policy{tags: tags, expr: expr, action: strings.ToLower(action)}
+	switch p.action {
+	case PolicyActionBlock, PolicyActionNxdomain, PolicyActionRefused:
+		if len(args) > 0 {
+			return nil, fmt.Errorf("policy action %s takes no args", p.action)
+		}
+	case PolicyActionSinkhole:
+		for _, arg := range args {
+			ip := net.ParseIP(arg)
+			if ip == nil {
+				return nil, fmt.Errorf("policy sinkhole ip %s error", arg)
+			}
+			if ip.To4() != nil {
+				p.sinkhole4 = ip.To4()
+			} else {
+				p.sinkhole6 = ip
+			}
+		}
+		if len(args) == 0 {
+			p.sinkhole4 = net.IPv4zero.To4()
+			p.sinkhole6 = net.IPv6zero
+		}
+	default:
+		return nil, fmt.Errorf("unsupported policy action %s", action)
+	}
+	return p, nil
+}
+
+func (p *policy) String() string {
+	if p.group != "" {
+		return fmt.Sprintf("%s:%s@%s", p.tags, p.action, p.group)
+	}
+	return fmt.Sprintf("%s:%s", p.tags, p.action)
+}
+
+// reply 按策略动作构造应答报文
+func (p *policy) reply(state *request.Request) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Authoritative = true
+	switch p.action {
+	case PolicyActionNxdomain:
+		m.Rcode = dns.RcodeNameError
+	case PolicyActionRefused:
+		m.Rcode = dns.RcodeRefused
+	case PolicyActionSinkhole:
+		hdr := dns.RR_Header{Name: state.QName(), Rrtype: state.QType(), Class: dns.ClassINET, Ttl: policyAnswerTTL}
+		switch {
+		case state.QType() == dns.TypeA && p.sinkhole4 != nil:
+			m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: p.sinkhole4})
+		case state.QType() == dns.TypeAAAA && p.sinkhole6 != nil:
+			m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr, AAAA: p.sinkhole6})
+		}
+	}
+	return m
+}
+
+// matchPolicy 按配置顺序匹配全局策略与客户端分组策略, 返回第一个命中的策略
+func (dh *Datahub) matchPolicy(group string, name string) *policy {
+	for _, p := range dh.policies {
+		if p.group != "" && p.group != group {
+			continue
+		}
+		if dh.MatchGroupTagExpr(group, p.expr, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// servePolicy 执行策略应答并统计结果
+func (dh *Datahub) servePolicy(p *policy, group string, state *request.Request) (int, error) {
+	dh.policyMatchStat.Incr(p.action, 1)
+	dh.incrGroupStat(group, "policy:"+p.action)
+	if p.action == PolicyActionNxdomain {
+		dh.metricsStat.Incr(MetricsStatNxdomain, 1)
+	}
+	m := p.reply(state)
+	if err := state.W.WriteMsg(m); err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	return dns.RcodeSuccess, nil
+}
@@ -0,0 +1,89 @@
+package datahub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+func TestDatahub_ServeDNSPolicy(t *testing.T) {
+	dh := NewDatahub()
+	dh.Next = test.NextHandler(dns.RcodeSuccess, nil)
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "ads", "ads domain doubleclick.net\nads full ad.example.com\n")
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "adult", "adult domain adult.example.org\n")
+	loadTestTable(t, dh, datatable.DateTypeKeywordTable, "tracking", "tracking tracker\n")
+	for _, args := range [][]string{
+		{"ads", PolicyActionNxdomain},
+		{"adult", PolicyActionSinkhole, "0.0.0.0", "::"},
+		{"tracking", PolicyActionRefused},
+	} {
+		p, err := newPolicy(args[0], args[1], args[2:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		dh.policies = append(dh.policies, p)
+	}
+
+	tests := []struct {
+		qname   string
+		qtype   uint16
+		rcode   int
+		answers int
+	}{
+		{"www.doubleclick.net.", dns.TypeA, dns.RcodeNameError, 0},
+		{"ad.example.com.", dns.TypeA, dns.RcodeNameError, 0},
+		{"www.adult.example.org.", dns.TypeA, dns.RcodeSuccess, 1},
+		{"www.adult.example.org.", dns.TypeAAAA, dns.RcodeSuccess, 1},
+		{"www.adult.example.org.", dns.TypeMX, dns.RcodeSuccess, 0},
+		{"x.tracker.net.", dns.TypeA, dns.RcodeRefused, 0},
+	}
+	for _, tc := range tests {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		if _, err := dh.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Msg == nil {
+			t.Fatalf("%s: no response written", tc.qname)
+		}
+		if rec.Msg.Rcode != tc.rcode || len(rec.Msg.Answer) != tc.answers {
+			t.Errorf("%s: got rcode %d answers %d, want %d %d",
+				tc.qname, rec.Msg.Rcode, len(rec.Msg.Answer), tc.rcode, tc.answers)
+		}
+	}
+
+	// 未命中策略时交给下一个插件
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	if _, err := dh.ServeDNS(context.Background(), rec, m); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Msg != nil {
+		t.Errorf("example.com: unexpected policy answer %v", rec.Msg)
+	}
+	if v := dh.policyMatchStat.GetValue(PolicyActionNxdomain); v != 2 {
+		t.Errorf("policy nxdomain stat %d, want 2", v)
+	}
+}
+
+func Test_newPolicy(t *testing.T) {
+	if _, err := newPolicy("ads", "drop", nil); err == nil {
+		t.Error("expected error for unsupported action")
+	}
+	if _, err := newPolicy("ads", PolicyActionSinkhole, []string{"x.x.x.x"}); err == nil {
+		t.Error("expected error for bad sinkhole ip")
+	}
+	p, err := newPolicy("ads", PolicyActionSinkhole, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.sinkhole4 == nil || p.sinkhole6 == nil {
+		t.Error("sinkhole default address not set")
+	}
+}
@@ -0,0 +1,81 @@
+package datahub
+
+import (
+	"net"
+	"strings"
+
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+// AnswerHook 应答 IP 标签回调, 下游插件应答后对每个 A/AAAA 记录调用一次
+type AnswerHook func(state *request.Request, ip net.IP, tags []string)
+
+// responseWriter 拦截下游插件的应答, 对应答 IP 做过滤与标签匹配
+type responseWriter struct {
+	dns.ResponseWriter
+	hub   *Datahub
+	state *request.Request
+}
+
+func (w *responseWriter) WriteMsg(res *dns.Msg) error {
+	if w.hub.answerFilter != nil {
+		res = w.hub.filterAnswers(res)
+	}
+	w.hub.tagAnswers(w.state, res)
+	return w.ResponseWriter.WriteMsg(res)
+}
+
+// AddAnswerHook 注册应答 IP 标签回调
+func (dh *Datahub) AddAnswerHook(hook AnswerHook) {
+	dh.answerHookLock.Lock()
+	defer dh.answerHookLock.Unlock()
+	dh.answerHooks = append(dh.answerHooks, hook)
+}
+
+// MatchAnswerIP 返回应答 IP 命中的 answer_tags 标签
+func (dh *Datahub) MatchAnswerIP(ip net.IP) []string {
+	inet := netutils.HostNet(ip)
+	var tags []string
+	for _, tag := range dh.answerTags {
+		if dh.MixMatchNet(tag, inet) {
+			tags = append(tags, strings.ToUpper(tag))
+		}
+	}
+	return tags
+}
+
+// answerIP 返回 A/AAAA 记录的地址, 其他记录返回 nil
+func answerIP(rr dns.RR) net.IP {
+	switch v := rr.(type) {
+	case *dns.A:
+		return v.A
+	case *dns.AAAA:
+		return v.AAAA
+	}
+	return nil
+}
+
+// tagAnswers 匹配应答中的 A/AAAA 记录, 统计并回调命中的标签
+func (dh *Datahub) tagAnswers(state *request.Request, res *dns.Msg) {
+	if res == nil {
+		return
+	}
+	dh.answerHookLock.RLock()
+	hooks := dh.answerHooks
+	dh.answerHookLock.RUnlock()
+	for _, rr := range res.Answer {
+		ip := answerIP(rr)
+		if ip == nil {
+			continue
+		}
+		tags := dh.MatchAnswerIP(ip)
+		for _, tag := range tags {
+			dh.answerMatchStat.Incr(tag, 1)
+		}
+		for _, hook := range hooks {
+			hook(state, ip, tags)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package datahub
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+)
+
+func TestDatahub_ServeDNSAnswerTags(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "cn", "cn 114.114.114.0/24\n")
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "v6", "v6 2001:db8::/32\n")
+	dh.answerTags = []string{"cn", "v6"}
+	dh.Next = test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = []dns.RR{
+			test.A("example.cn. 60 IN A 114.114.114.114"),
+			test.A("example.cn. 60 IN A 8.8.8.8"),
+			test.AAAA("example.cn. 60 IN AAAA 2001:db8::1"),
+		}
+		_ = w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+
+	var hooked = make(map[string][]string)
+	dh.AddAnswerHook(func(state *request.Request, ip net.IP, tags []string) {
+		hooked[ip.String()] = tags
+	})
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	m := new(dns.Msg)
+	m.SetQuestion("example.cn.", dns.TypeA)
+	if _, err := dh.ServeDNS(context.Background(), rec, m); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Msg.Answer) != 3 {
+		t.Fatalf("answers %d, want 3", len(rec.Msg.Answer))
+	}
+	if len(hooked) != 3 {
+		t.Fatalf("hook called for %d ips, want 3", len(hooked))
+	}
+	if tags := hooked["114.114.114.114"]; len(tags) != 1 || tags[0] != "CN" {
+		t.Errorf("114.114.114.114 tags %v, want [CN]", tags)
+	}
+	if tags := hooked["8.8.8.8"]; len(tags) != 0 {
+		t.Errorf("8.8.8.8 tags %v, want []", tags)
+	}
+	if tags := hooked["2001:db8::1"]; len(tags) != 1 || tags[0] != "V6" {
+		t.Errorf("2001:db8::1 tags %v, want [V6]", tags)
+	}
+	if v := dh.answerMatchStat.GetValue("CN"); v != 1 {
+		t.Errorf("answer stat CN %d, want 1", v)
+	}
+}
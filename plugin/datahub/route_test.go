@@ -0,0 +1,153 @@
+package datahub
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+// newTestUpstream 启动本地 DNS 服务(udp/tcp 同端口), 对所有 A 查询返回 ip
+func newTestUpstream(t *testing.T, ip string) string {
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if r.Question[0].Qtype == dns.TypeA {
+			m.Answer = append(m.Answer, test.A(r.Question[0].Name+" 60 IN A "+ip))
+		}
+		_ = w.WriteMsg(m)
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := net.ListenPacket("udp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*dns.Server{{Listener: l, Handler: handler}, {PacketConn: pc, Handler: handler}} {
+		started := make(chan struct{})
+		s.NotifyStartedFunc = func() { close(started) }
+		go func(s *dns.Server) { _ = s.ActivateAndServe() }(s)
+		<-started
+		t.Cleanup(func() { _ = s.Shutdown() })
+	}
+	return l.Addr().String()
+}
+
+func TestDatahub_ServeDNSRoute(t *testing.T) {
+	domestic := newTestUpstream(t, "1.1.1.1")
+	foreign := newTestUpstream(t, "2.2.2.2")
+
+	dh := NewDatahub()
+	dh.Next = test.ErrorHandler()
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "cn", "cn domain baidu.com\n")
+	for _, args := range [][]string{
+		{"cn", domestic},
+		{RouteDefault, "tcp://" + foreign},
+	} {
+		rt, err := newRoute(args[0], args[1:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		dh.routes = append(dh.routes, rt)
+	}
+
+	tests := map[string]string{
+		"www.baidu.com.":  "1.1.1.1",
+		"www.google.com.": "2.2.2.2",
+	}
+	for qname, want := range tests {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		m := new(dns.Msg)
+		m.SetQuestion(qname, dns.TypeA)
+		if _, err := dh.ServeDNS(context.Background(), rec, m); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Msg == nil || len(rec.Msg.Answer) != 1 {
+			t.Fatalf("%s: unexpected response %v", qname, rec.Msg)
+		}
+		if got := rec.Msg.Answer[0].(*dns.A).A.String(); got != want {
+			t.Errorf("%s: routed answer %s, want %s", qname, got, want)
+		}
+	}
+	if v := dh.routeMatchStat.GetValue("cn"); v != 1 {
+		t.Errorf("route stat cn %d, want 1", v)
+	}
+}
+
+func TestRoute_Failover(t *testing.T) {
+	live := newTestUpstream(t, "1.1.1.1")
+	rt, err := newRoute("!cn", []string{"127.0.0.1:1", live})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.expr.String() != "!CN" {
+		t.Fatalf("route tags parse error %v", rt)
+	}
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	dead := rt.upstreams[0]
+	for i := 0; i < routeMaxFails; i++ {
+		if dead.down() {
+			t.Fatalf("upstream down after %d fails, want %d", i, routeMaxFails)
+		}
+		if _, err := dead.exchange(context.Background(), m); err == nil {
+			t.Fatal("expected error from dead upstream")
+		}
+	}
+	if !dead.down() {
+		t.Fatalf("upstream should be down after %d fails", routeMaxFails)
+	}
+	for i := 0; i < routeMaxFails+1; i++ {
+		if _, err := rt.exchange(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !dead.down() {
+		t.Error("down upstream should be skipped while another is healthy")
+	}
+
+	// 上游恢复后由健康检查重新标记为可用
+	dead.addr = live
+	dead.healthcheck()
+	if dead.down() {
+		t.Error("upstream should be up after a successful healthcheck")
+	}
+}
+
+func Test_newUpstream(t *testing.T) {
+	tests := map[string]string{
+		"114.114.114.114":          "udp://114.114.114.114:53",
+		"tcp://1.1.1.1:5353":       "tcp://1.1.1.1:5353",
+		"tls://dns.google":         "tcp-tls://dns.google:853",
+		"tls://8.8.8.8@dns.google": "tcp-tls://8.8.8.8:853",
+		"[2400:3200::1]:53":        "udp://[2400:3200::1]:53",
+	}
+	for spec, want := range tests {
+		u, err := newUpstream(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := u.proto + "://" + u.addr; got != want {
+			t.Errorf("upstream %s = %s, want %s", spec, got, want)
+		}
+	}
+	if _, err := newUpstream("https://dns.google"); err == nil {
+		t.Error("expected error for unsupported protocol")
+	}
+	if _, err := newUpstream("tls://1.1.1.1"); err == nil {
+		t.Error("expected error for tls upstream ip without servername")
+	}
+	u, err := newUpstream("tls://1.1.1.1@one.one.one.one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := u.client.TLSConfig; cfg.ServerName != "one.one.one.one" || cfg.InsecureSkipVerify {
+		t.Errorf("tls config %+v", cfg)
+	}
+}
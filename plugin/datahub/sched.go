@@ -13,6 +13,8 @@ func (dh *Datahub) startSched() {
 
 	_, _ = dh.sched.AddFunc(dh.reloadCron, func() {
 		dh.cronUpdateKeywordTableMap()
+		dh.cronUpdateHostsTableMap()
+		dh.cronUpdateAsnTableMap()
 	})
 
 	_, _ = dh.sched.AddFunc("@every 60s", func() {
@@ -20,6 +22,14 @@ func (dh *Datahub) startSched() {
 		dh.dayNetworkChartStat.Update(dh.networkMatchStat)
 	})
 
+	if dh.geoipMmdb != nil {
+		_, _ = dh.sched.AddFunc(geoipMmdbReloadCron, dh.reloadGeoipMmdb)
+	}
+
+	if len(dh.routes) > 0 {
+		_, _ = dh.sched.AddFunc(routeHealthcheckCron, dh.healthcheckRoutes)
+	}
+
 	dh.sched.Start()
 }
 
@@ -38,3 +48,19 @@ func (dh *Datahub) cronUpdateKeywordTableMap() {
 		}
 	}
 }
+
+func (dh *Datahub) cronUpdateAsnTableMap() {
+	for _, _item := range dh.asnTableMap.Items() {
+		item := _item.(*datatable.DataTable)
+		item.LoadFromFile()
+		item.LoadFromUrl()
+	}
+}
+
+func (dh *Datahub) cronUpdateHostsTableMap() {
+	for _, _item := range dh.hostsTableMap.Items() {
+		item := _item.(*datatable.DataTable)
+		item.LoadFromFile()
+		item.LoadFromUrl()
+	}
+}
@@ -0,0 +1,227 @@
+package datahub
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ca17/datahub/plugin/pkg/stats"
+	"github.com/robfig/cron/v3"
+)
+
+// tagWindow 标签生效时间窗口, 每次 cron 触发后持续 dur
+type tagWindow struct {
+	spec  string
+	sched cron.Schedule
+	dur   time.Duration
+}
+
+// active 判断 now 是否处于某次触发后的 dur 之内
+func (w *tagWindow) active(now time.Time) bool {
+	return !w.sched.Next(now.Add(-w.dur)).After(now)
+}
+
+// nextChange 返回窗口状态下一次变化的时间
+func (w *tagWindow) nextChange(now time.Time, active bool) time.Time {
+	if active {
+		return w.sched.Next(now.Add(-w.dur)).Add(w.dur)
+	}
+	return w.sched.Next(now)
+}
+
+func (w *tagWindow) String() string {
+	return w.spec + " " + w.dur.String()
+}
+
+// parseTagWindow 解析时间窗口, 支持两种格式:
+//
+//	cron 表达式 + 持续时间, 如 `0 0 8 * * 1-5 10h`, `@daily 2h`
+//	[星期] 开始时间-结束时间, 如 `mon-fri 08:00-18:00`, `sat,sun 22:00-06:00`, `09:00-12:00`
+func parseTagWindow(args []string) (*tagWindow, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("schedule spec is empty")
+	}
+	if n := len(args); n >= 2 {
+		if dur, err := time.ParseDuration(args[n-1]); err == nil {
+			if dur <= 0 {
+				return nil, fmt.Errorf("schedule duration %s must > 0", args[n-1])
+			}
+			spec := strings.Join(args[:n-1], " ")
+			sched, err := cronParser.Parse(spec)
+			if err != nil {
+				return nil, fmt.Errorf("schedule cron %s error %s", spec, err.Error())
+			}
+			return &tagWindow{spec: spec, sched: sched, dur: dur}, nil
+		}
+	}
+	if len(args) > 2 {
+		return nil, fmt.Errorf("schedule spec %s format error", strings.Join(args, " "))
+	}
+	days := "*"
+	if len(args) == 2 {
+		days = args[0]
+		if strings.EqualFold(days, "daily") {
+			days = "*"
+		}
+	}
+	window := args[len(args)-1]
+	times := strings.SplitN(window, "-", 2)
+	if len(times) != 2 {
+		return nil, fmt.Errorf("schedule window %s format is hh:mm-hh:mm", window)
+	}
+	start, err := parseClock(times[0])
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(times[1])
+	if err != nil {
+		return nil, err
+	}
+	dur := end - start
+	if dur <= 0 {
+		// 跨越午夜
+		dur += 24 * time.Hour
+	}
+	spec := fmt.Sprintf("0 %d %d * * %s", int(start.Minutes())%60, int(start.Hours()), days)
+	sched, err := cronParser.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("schedule days %s error %s", days, err.Error())
+	}
+	return &tagWindow{spec: spec, sched: sched, dur: dur}, nil
+}
+
+// parseClock 解析 hh:mm, 返回距零点的时长
+func parseClock(s string) (time.Duration, error) {
+	hm := strings.SplitN(s, ":", 2)
+	if len(hm) == 2 {
+		h, err1 := strconv.Atoi(hm[0])
+		m, err2 := strconv.Atoi(hm[1])
+		if err1 == nil && err2 == nil && h >= 0 && h < 24 && m >= 0 && m < 60 {
+			return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+		}
+	}
+	return 0, fmt.Errorf("schedule time %s format is hh:mm", s)
+}
+
+// tagSchedule 标签的全部时间窗口, 任一窗口生效时标签生效.
+// 状态在下一次变化前保持不变, 变化时使匹配缓存失效
+type tagSchedule struct {
+	sync.Mutex
+	tag     string
+	windows []*tagWindow
+	active  bool
+	until   time.Time
+}
+
+// ScheduleState 标签定时生效状态
+type ScheduleState struct {
+	Tag     string    `json:"tag"`
+	Active  bool      `json:"active"`
+	Until   time.Time `json:"until"` // 状态保持到该时间
+	Windows []string  `json:"windows"`
+}
+
+// refresh 返回 now 时的生效状态, 状态变化时调用 changed
+func (s *tagSchedule) refresh(now time.Time, changed func(tag string)) bool {
+	s.Lock()
+	defer s.Unlock()
+	if now.Before(s.until) {
+		return s.active
+	}
+	active := false
+	for _, w := range s.windows {
+		if w.active(now) {
+			active = true
+			break
+		}
+	}
+	var until time.Time
+	for _, w := range s.windows {
+		// 生效时取最早结束的生效窗口, 未生效时取最早开始的窗口
+		if active && !w.active(now) {
+			continue
+		}
+		if t := w.nextChange(now, active); until.IsZero() || t.Before(until) {
+			until = t
+		}
+	}
+	if active != s.active || s.until.IsZero() {
+		defer changed(s.tag)
+	}
+	s.active, s.until = active, until
+	return active
+}
+
+func (s *tagSchedule) state() ScheduleState {
+	s.Lock()
+	defer s.Unlock()
+	st := ScheduleState{Tag: s.tag, Active: s.active, Until: s.until}
+	for _, w := range s.windows {
+		st.Windows = append(st.Windows, w.String())
+	}
+	return st
+}
+
+// addSchedule 为标签添加时间窗口
+func (dh *Datahub) addSchedule(tag string, w *tagWindow) {
+	tag = strings.ToUpper(tag)
+	if dh.schedules == nil {
+		dh.schedules = make(map[string]*tagSchedule)
+	}
+	s, ok := dh.schedules[tag]
+	if !ok {
+		s = &tagSchedule{tag: tag}
+		dh.schedules[tag] = s
+	}
+	s.windows = append(s.windows, w)
+}
+
+// tagActive 判断标签当前是否生效, 未配置时间窗口的标签始终生效, 分组数据表使用分组外的标签名
+func (dh *Datahub) tagActive(tag string) bool {
+	if len(dh.schedules) == 0 {
+		return true
+	}
+	if i := strings.LastIndex(tag, groupTagSep); i >= 0 {
+		tag = tag[i+1:]
+	}
+	s, ok := dh.schedules[tag]
+	if !ok {
+		return true
+	}
+	return s.refresh(time.Now(), dh.matchCache.invalidate)
+}
+
+// refreshSchedules 刷新全部标签的生效状态, 用于涉及多个标签的缓存查询之前
+func (dh *Datahub) refreshSchedules() {
+	now := time.Now()
+	for _, s := range dh.schedules {
+		s.refresh(now, dh.matchCache.invalidate)
+	}
+}
+
+// ScheduleStates 查询定时生效标签的状态, 按标签排序
+func (dh *Datahub) ScheduleStates() []ScheduleState {
+	dh.refreshSchedules()
+	result := make([]ScheduleState, 0, len(dh.schedules))
+	for _, s := range dh.schedules {
+		result = append(result, s.state())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Tag < result[j].Tag })
+	return result
+}
+
+// ScheduleStats 定时生效标签统计, 生效为 1, 未生效为 0
+func (dh *Datahub) ScheduleStats() []stats.Counter {
+	result := make([]stats.Counter, 0, len(dh.schedules))
+	for _, st := range dh.ScheduleStates() {
+		var v int64
+		if st.Active {
+			v = 1
+		}
+		result = append(result, *stats.NewCounter(st.Tag, v))
+	}
+	return result
+}
@@ -0,0 +1,179 @@
+package datahub
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/c-robinson/iplib"
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+	"github.com/coredns/caddy"
+)
+
+func TestParseTagWindow(t *testing.T) {
+	// 2021-12-06 为星期一
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2021, 12, day, hour, min, 0, 0, time.Local)
+	}
+	cases := []struct {
+		spec   []string
+		now    time.Time
+		active bool
+		next   time.Time
+	}{
+		{[]string{"mon-fri", "08:00-18:00"}, at(6, 9, 30), true, at(6, 18, 0)},
+		{[]string{"mon-fri", "08:00-18:00"}, at(6, 18, 0), false, at(7, 8, 0)},
+		{[]string{"mon-fri", "08:00-18:00"}, at(11, 9, 0), false, at(13, 8, 0)},
+		{[]string{"sat,sun", "22:00-06:00"}, at(12, 5, 59), true, at(12, 6, 0)},
+		{[]string{"09:30-12:00"}, at(8, 9, 29), false, at(8, 9, 30)},
+		{[]string{"0", "0", "8", "*", "*", "1-5", "10h"}, at(10, 17, 59), true, at(10, 18, 0)},
+		{[]string{"@daily", "2h"}, at(7, 1, 0), true, at(7, 2, 0)},
+	}
+	for _, c := range cases {
+		w, err := parseTagWindow(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		active := w.active(c.now)
+		if active != c.active || !w.nextChange(c.now, active).Equal(c.next) {
+			t.Errorf("%v at %v: active %v next %v", c.spec, c.now, active, w.nextChange(c.now, active))
+		}
+	}
+	for _, spec := range [][]string{{"mon-fri"}, {"25:00-26:00"}, {"funday", "08:00-09:00"}, {"* * *", "1h"}, {"@daily", "-1h"}, {"a", "b", "08:00-09:00"}} {
+		if _, err := parseTagWindow(spec); err == nil {
+			t.Errorf("%v: expected error", spec)
+		}
+	}
+}
+
+func TestDatahub_Schedule(t *testing.T) {
+	c := caddy.NewTestController("dns", `datahub {
+        schedule games 00:00-00:00
+        schedule ads "0 0 0 1 1 *" 1s
+    }`)
+	dh, err := parseConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "games", "games domain steampowered.com\n")
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "ads", "ads domain doubleclick.net\n")
+
+	if !dh.MixMatch("games", "store.steampowered.com") {
+		t.Error("games should be active")
+	}
+	if dh.MixMatch("ads", "doubleclick.net") || dh.MixMatchTags([]string{"ads"}, "doubleclick.net", false) {
+		t.Error("ads should be inactive")
+	}
+	if tags := dh.TagsOf("doubleclick.net"); len(tags) != 0 {
+		t.Errorf("TagsOf inactive tag = %v", tags)
+	}
+	if e := dh.Explain("ads", "doubleclick.net"); e.Matched || !e.Inactive {
+		t.Errorf("Explain = %+v", e)
+	}
+	expr, _ := CompileTagExpr("!ads")
+	if !dh.MatchTagExpr(expr, "doubleclick.net") {
+		t.Error("inactive tag should not match in expressions")
+	}
+
+	st := dh.ScheduleStats()
+	if len(st) != 2 || st[0].Name != "ADS" || st[0].Value != 0 || st[1].Name != "GAMES" || st[1].Value != 1 {
+		t.Errorf("schedule stats %v", st)
+	}
+
+	// 状态变化时表达式缓存失效
+	s := dh.schedules["ADS"]
+	s.windows[0].dur = 24 * 366 * time.Hour
+	s.until = time.Time{}
+	if dh.MatchTagExpr(expr, "doubleclick.net") {
+		t.Error("expression cache not invalidated when schedule becomes active")
+	}
+
+	for _, conf := range []string{"schedule games", "schedule games mon-fri", "schedule games 0 0 8 * * 1-5 0s"} {
+		c := caddy.NewTestController("dns", "datahub {\n"+conf+"\n}")
+		if _, err := parseConfig(c); err == nil {
+			t.Errorf("%s: expected error", conf)
+		}
+	}
+}
+
+func TestDatahub_ScheduleNet(t *testing.T) {
+	c := caddy.NewTestController("dns", `datahub {
+        schedule lan "0 0 0 1 1 *" 1s
+    }`)
+	dh, err := parseConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "lan", "lan 10.0.0.0/8\n")
+	expr, _ := CompileTagExpr("!lan")
+	inet, _ := netutils.ParseIpNet("10.1.1.1")
+
+	if dh.MixMatchNetByStr("lan", "10.1.1.1") || dh.MatchNetByStr("lan", "10.1.1.1") {
+		t.Error("lan should be inactive")
+	}
+	if tags := dh.TagsOfIP("10.1.1.1"); len(tags) != 0 {
+		t.Errorf("TagsOfIP inactive tag = %v", tags)
+	}
+	if e := dh.ExplainNet("lan", "10.1.1.1"); e.Matched || !e.Inactive || e.Rule != "10.0.0.0/8" {
+		t.Errorf("ExplainNet = %+v", e)
+	}
+	if !dh.MatchTagExprNet(expr, inet) {
+		t.Error("inactive tag should not match in net expressions")
+	}
+
+	s := dh.schedules["LAN"]
+	s.windows[0].dur = 24 * 366 * time.Hour
+	s.until = time.Time{}
+	if !dh.MixMatchNetByStr("lan", "10.1.1.1") || !dh.MatchNetByStr("lan", "10.1.1.1") {
+		t.Error("lan should be active")
+	}
+	waitTagIndex(t, dh)
+	if tags := dh.TagsOfIP("10.1.1.1"); len(tags) != 1 || tags[0] != "LAN" {
+		t.Errorf("TagsOfIP active tag = %v", tags)
+	}
+	if dh.MatchTagExprNet(expr, inet) {
+		t.Error("net expression cache not invalidated when schedule becomes active")
+	}
+}
+
+func TestDatahub_ScheduleGeoKeyword(t *testing.T) {
+	c := caddy.NewTestController("dns", `datahub {
+        schedule cn "0 0 0 1 1 *" 1s
+        schedule track "0 0 0 1 1 *" 1s
+    }`)
+	dh, err := parseConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadTestTable(t, dh, datatable.DateTypeKeywordTable, "track", "track tracker\n")
+	inet, _ := netutils.ParseIpNet("1.2.3.0/24")
+	dh.geoipNetListMap["CN"] = netutils.NewNetList([]iplib.Net{inet})
+	geosite := netutils.NewDomainList()
+	geosite.Add(netutils.MatchDomainType, "baidu.com")
+	dh.geositeDoaminListMap["CN"] = geosite
+
+	if dh.MatchGeoip("cn", net.ParseIP("1.2.3.4")) || dh.MatchGeoNet("cn", inet) {
+		t.Error("inactive geoip tag should not match")
+	}
+	if dh.MatchGeosite(netutils.MatchDomainType, "cn", "www.baidu.com") {
+		t.Error("inactive geosite tag should not match")
+	}
+	if _, ok := dh.LookupKeyword("track", "tracker.example.com"); ok || dh.MatchKeyword("track", "tracker.example.com") {
+		t.Error("inactive keyword tag should not match")
+	}
+
+	for _, s := range dh.schedules {
+		s.windows[0].dur = 24 * 366 * time.Hour
+		s.until = time.Time{}
+	}
+	if !dh.MatchGeoip("cn", net.ParseIP("1.2.3.4")) || !dh.MatchGeoNet("cn", inet) {
+		t.Error("active geoip tag should match")
+	}
+	if !dh.MatchGeosite(netutils.MatchDomainType, "cn", "www.baidu.com") {
+		t.Error("active geosite tag should match")
+	}
+	if word, ok := dh.LookupKeyword("track", "tracker.example.com"); !ok || word != "tracker" || !dh.MatchKeyword("track", "tracker.example.com") {
+		t.Error("active keyword tag should match")
+	}
+}
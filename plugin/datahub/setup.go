@@ -2,9 +2,12 @@ package datahub
 
 import (
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/ca17/datahub/plugin/pkg/mmdb"
 	"github.com/ca17/dnssrc/plugin/pkg/validutil"
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
@@ -49,6 +52,8 @@ func setup(c *caddy.Controller) error {
 
 func parseConfig(c *caddy.Controller) (*Datahub, error) {
 	d := NewDatahub()
+	// 数据表与策略引用的客户端分组, 解析完成后校验
+	var groupRefs []string
 	i := 0
 	for c.Next() {
 		if i > 0 {
@@ -73,6 +78,17 @@ func parseConfig(c *caddy.Controller) (*Datahub, error) {
 				}
 				d.geoipPath = remaining[0]
 				log.Info("geoip_path ", d.geoipPath)
+			case "geoip_mmdb":
+				remaining := c.RemainingArgs()
+				if len(remaining) != 1 {
+					return nil, c.Errf("geoip_mmdb format is `geoip_mmdb filepath` ")
+				}
+				reader, err := mmdb.Open(remaining[0])
+				if err != nil {
+					return nil, c.Errf("load geoip_mmdb error %s", err.Error())
+				}
+				d.geoipMmdb = reader
+				log.Infof("geoip_mmdb %s %s", remaining[0], reader.DatabaseType())
 			case "geosite_path":
 				remaining := c.RemainingArgs()
 				plen := len(remaining)
@@ -107,7 +123,7 @@ func parseConfig(c *caddy.Controller) (*Datahub, error) {
 				}
 				log.Info("geosite_cache ", d.geositeCacheTags)
 				for k, v := range d.geositeDoaminListMap {
-					log.Infof("geosite_cache %s full_domain:%d regex_domain:%d", k, v.FullLen(), v.RegexLen())
+					log.Infof("geosite_cache %s full_domain:%d keyword_domain:%d regex_domain:%d", k, v.FullLen(), v.KeywordLen(), v.RegexLen())
 				}
 			case "geodat_upgrade_url":
 				remaining := c.RemainingArgs()
@@ -129,45 +145,184 @@ func parseConfig(c *caddy.Controller) (*Datahub, error) {
 				d.geodatUpgradeCron = cronSpec
 				log.Info("geodat_upgrade_cron ", d.geodatUpgradeCron)
 			case "keyword_table":
-				remaining := c.RemainingArgs()
+				remaining, group := splitGroupArgs(c.RemainingArgs())
 				plen := len(remaining)
 				if plen != 2 {
 					return nil, c.ArgErr()
 				}
-				d.parseDataTableByTag(datatable.DateTypeKeywordTable, strings.Split(remaining[0], ","), remaining[1])
+				if group != "" {
+					groupRefs = append(groupRefs, group)
+				}
+				d.parseGroupDataTableByTag(group, datatable.DateTypeKeywordTable, strings.Split(remaining[0], ","), remaining[1])
 				d.keywordTableMap.IterCb(func(k string, v interface{}) {
 					log.Infof("keyword_table %s total %d", k, v.(*datatable.DataTable).Len())
 				})
 			case "domain_table":
-				remaining := c.RemainingArgs()
+				remaining, group := splitGroupArgs(c.RemainingArgs())
+				format := datatable.DomainFormatAuto
+				if n := len(remaining); n == 4 && remaining[2] == "format" {
+					if !datatable.IsDomainFormat(remaining[3]) {
+						return nil, c.Errf("domain_table format must be auto|native|abp ")
+					}
+					remaining, format = remaining[:2], remaining[3]
+				}
 				plen := len(remaining)
 				if plen != 2 {
 					return nil, c.Errf("domain_table args num is 2 ")
 				}
-				d.parseDataTableByTag(datatable.DateTypeDomainlistTable, strings.Split(remaining[0], ","), remaining[1])
+				if group != "" {
+					groupRefs = append(groupRefs, group)
+				}
+				d.parseGroupDomainTableByTag(group, strings.Split(remaining[0], ","), remaining[1], format)
 				d.domainTableMap.IterCb(func(k string, v interface{}) {
 					log.Infof("domain_table %s total %d", k, v.(*datatable.DataTable).Len())
+					if u := v.(*datatable.DataTable).GetData().(*datatable.DomainData).Unsupported(); u.Count > 0 {
+						log.Warningf("domain_table %s unsupported %d rules, e.g. %s", k, u.Count, strings.Join(u.Samples, "; "))
+					}
 				})
 			case "netlist_table":
-				remaining := c.RemainingArgs()
+				remaining, group := splitGroupArgs(c.RemainingArgs())
 				plen := len(remaining)
 				if plen != 2 {
 					return nil, c.ArgErr()
 				}
-				d.parseDataTableByTag(datatable.DateTypeNetlistTable, strings.Split(remaining[0], ","), remaining[1])
+				if group != "" {
+					groupRefs = append(groupRefs, group)
+				}
+				d.parseGroupDataTableByTag(group, datatable.DateTypeNetlistTable, strings.Split(remaining[0], ","), remaining[1])
 				d.netlistTableMap.IterCb(func(k string, v interface{}) {
 					log.Infof("netlist_table %s total %d", k, v.(*datatable.DataTable).Len())
 				})
 			case "ecs_table":
-				remaining := c.RemainingArgs()
+				remaining, group := splitGroupArgs(c.RemainingArgs())
 				plen := len(remaining)
 				if plen != 2 {
 					return nil, c.ArgErr()
 				}
-				d.parseDataTableByTag(datatable.DateTypeEcsTable, strings.Split(remaining[0], ","), remaining[1])
+				if group != "" {
+					groupRefs = append(groupRefs, group)
+				}
+				d.parseGroupDataTableByTag(group, datatable.DateTypeEcsTable, strings.Split(remaining[0], ","), remaining[1])
 				d.ecsTableMap.IterCb(func(k string, v interface{}) {
 					log.Infof("ecs_table %s total %d", k, v.(*datatable.DataTable).Len())
 				})
+			case "schedule":
+				remaining := c.RemainingArgs()
+				if len(remaining) < 2 {
+					return nil, c.Errf("schedule format is `schedule tag,tag... [days] hh:mm-hh:mm|cron duration` ")
+				}
+				w, err := parseTagWindow(remaining[1:])
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				for _, tag := range strings.Split(remaining[0], ",") {
+					d.addSchedule(tag, w)
+				}
+				log.Infof("schedule %s %s", remaining[0], w)
+			case "policy":
+				remaining, group := splitGroupArgs(c.RemainingArgs())
+				plen := len(remaining)
+				if plen < 2 {
+					return nil, c.Errf("policy format is `policy tag,tag...|expr block|nxdomain|refused|sinkhole [ip...] [group name]` ")
+				}
+				p, err := newPolicy(remaining[0], remaining[1], remaining[2:])
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				if group != "" {
+					p.group = group
+					groupRefs = append(groupRefs, group)
+				}
+				d.policies = append(d.policies, p)
+				log.Info("policy ", p)
+			case "ecs_apply":
+				remaining := c.RemainingArgs()
+				plen := len(remaining)
+				if plen < 1 {
+					return nil, c.Errf("ecs_apply format is `ecs_apply tag [source_prefix_v4] [source_prefix_v6] [replace|keep|strip]` ")
+				}
+				e, err := newEcsApply(remaining[0], remaining[1:])
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				d.ecsApply = e
+				log.Info("ecs_apply ", e)
+			case "client_group":
+				remaining := c.RemainingArgs()
+				plen := len(remaining)
+				if plen < 2 {
+					return nil, c.Errf("client_group format is `client_group name netlist:tag|geoip:tag...` ")
+				}
+				g, err := newClientGroup(remaining[0], remaining[1:])
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				if d.getClientGroup(g.name) != nil {
+					return nil, c.Errf("client_group %s duplicate", g.name)
+				}
+				d.groups = append(d.groups, g)
+				log.Info("client_group ", g)
+			case "route":
+				remaining := c.RemainingArgs()
+				plen := len(remaining)
+				if plen < 2 {
+					return nil, c.Errf("route format is `route [!]tag,tag...|expr|default upstream...` ")
+				}
+				rt, err := newRoute(remaining[0], remaining[1:])
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				d.routes = append(d.routes, rt)
+				log.Info("route ", rt)
+			case "filter_answers":
+				remaining := c.RemainingArgs()
+				plen := len(remaining)
+				if plen < 1 {
+					return nil, c.Errf("filter_answers format is `filter_answers tag,tag...|expr [drop|servfail|nxdomain]` ")
+				}
+				f, err := newAnswerFilter(remaining[0], remaining[1:])
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				d.answerFilter = f
+				log.Info("filter_answers ", f)
+			case "answer_tags":
+				d.answerTags = c.RemainingArgs()
+				if len(d.answerTags) < 1 {
+					return nil, c.Errf("answer_tags format is `answer_tags tag...` ")
+				}
+				log.Info("answer_tags ", d.answerTags)
+			case "hosts_table":
+				remaining, group := splitGroupArgs(c.RemainingArgs())
+				plen := len(remaining)
+				if plen < 2 {
+					return nil, c.Errf("hosts_table format is `hosts_table tag,tag... file|url|record...` ")
+				}
+				if group != "" {
+					groupRefs = append(groupRefs, group)
+				}
+				tags := strings.Split(remaining[0], ",")
+				if plen == 2 {
+					d.parseGroupDataTableByTag(group, datatable.DateTypeHostsTable, tags, remaining[1])
+				} else {
+					// 行内记录, 如 hosts_table office 10.0.0.1 printer.lan
+					for _, tag := range tags {
+						inline := strings.ToUpper(tag) + " " + strings.Join(remaining[1:], " ")
+						d.parseGroupDataTableByTag(group, datatable.DateTypeHostsTable, []string{tag}, inline)
+					}
+				}
+				d.hostsTableMap.IterCb(func(k string, v interface{}) {
+					log.Infof("hosts_table %s total %d", k, v.(*datatable.DataTable).Len())
+				})
+			case "asn_table":
+				remaining := c.RemainingArgs()
+				if len(remaining) != 2 {
+					return nil, c.Errf("asn_table format is `asn_table tag file|url` ")
+				}
+				d.parseDataTableByTag(datatable.DateTypeAsnTable, strings.Split(remaining[0], ","), remaining[1])
+				d.asnTableMap.IterCb(func(k string, v interface{}) {
+					log.Infof("asn_table %s total %d", k, v.(*datatable.DataTable).Len())
+				})
 			case "datapub_listen":
 				remaining := c.RemainingArgs()
 				plen := len(remaining)
@@ -206,6 +361,32 @@ func parseConfig(c *caddy.Controller) (*Datahub, error) {
 					return nil, c.Errf("reload_cron format must cron string ")
 				}
 				d.reloadCron = reloadCron
+			case "match_cache":
+				remaining := c.RemainingArgs()
+				plen := len(remaining)
+				if plen < 1 || plen > 2 {
+					return nil, c.Errf("match_cache format is `match_cache ttl|off [max_size_mb]` ")
+				}
+				var ttl time.Duration
+				if remaining[0] != "off" {
+					var err error
+					if ttl, err = time.ParseDuration(remaining[0]); err != nil || ttl <= 0 {
+						return nil, c.Errf("match_cache ttl %s error", remaining[0])
+					}
+				}
+				size := 0
+				if plen == 2 {
+					var err error
+					if size, err = strconv.Atoi(remaining[1]); err != nil || size < 0 {
+						return nil, c.Errf("match_cache max_size_mb %s error", remaining[1])
+					}
+				}
+				mc, err := newMatchCache(ttl, size)
+				if err != nil {
+					return nil, c.Errf("match_cache %s", err.Error())
+				}
+				d.matchCache = mc
+				log.Infof("match_cache ttl %s max_size %dMB", ttl, size)
 			case "debug":
 				d.debug = true
 			default:
@@ -213,5 +394,15 @@ func parseConfig(c *caddy.Controller) (*Datahub, error) {
 			}
 		}
 	}
+	for _, group := range groupRefs {
+		if d.getClientGroup(group) == nil {
+			return nil, c.Errf("client_group %s not defined", group)
+		}
+	}
+	for _, rt := range d.routes {
+		for _, u := range rt.upstreams {
+			u.setBootstrap(d.bootstrap)
+		}
+	}
 	return d, nil
 }
@@ -27,3 +27,25 @@ func Test_parseConfig(t *testing.T) {
 	}
 	t.Log(ecs)
 }
+
+func Test_parseConfigPolicy(t *testing.T) {
+	c := caddy.NewTestController("dns", `datahub {
+        policy ads,malware nxdomain
+        policy adult sinkhole 0.0.0.0 ::
+        policy tracking refused
+    }`)
+	dh, err := parseConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dh.policies) != 3 {
+		t.Fatalf("policies len %d, want 3", len(dh.policies))
+	}
+
+	c = caddy.NewTestController("dns", `datahub {
+        policy ads drop
+    }`)
+	if _, err := parseConfig(c); err == nil {
+		t.Fatal("expected error for unsupported policy action")
+	}
+}
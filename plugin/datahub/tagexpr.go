@@ -0,0 +1,85 @@
+package datahub
+
+import (
+	"strings"
+
+	"github.com/c-robinson/iplib"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+	"github.com/ca17/datahub/plugin/pkg/tagexpr"
+)
+
+const (
+	exprCachePrefix    = "expr:"
+	exprNetCachePrefix = "exprnet:"
+	exprMatcher        = "expr"
+)
+
+// CompileTagExpr 编译标签表达式, 如 `cn & !ads`, 编译结果可重复用于 MatchTagExpr
+func CompileTagExpr(s string) (*tagexpr.Expr, error) {
+	return tagexpr.Parse(s)
+}
+
+// getTagExpr 返回已编译的标签表达式, 首次使用时编译
+func (dh *Datahub) getTagExpr(s string) (*tagexpr.Expr, error) {
+	if v, ok := dh.tagExprMap.Get(s); ok {
+		return v.(*tagexpr.Expr), nil
+	}
+	expr, err := tagexpr.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	dh.tagExprMap.Set(s, expr)
+	return expr, nil
+}
+
+// MixMatchExpr 按标签表达式混合模式匹配域名, 表达式错误时返回 false
+func (dh *Datahub) MixMatchExpr(s string, name string) bool {
+	expr, err := dh.getTagExpr(s)
+	if err != nil {
+		log.Errorf("MixMatchExpr %s", err.Error())
+		return false
+	}
+	return dh.MatchTagExpr(expr, name)
+}
+
+// MatchTagExpr 按标签表达式混合模式匹配域名
+func (dh *Datahub) MatchTagExpr(expr *tagexpr.Expr, name string) bool {
+	return dh.MatchGroupTagExpr("", expr, name)
+}
+
+// MatchGroupTagExpr 按客户端分组及标签表达式匹配域名, 标签按短路规则求值, 匹配与未匹配结果均缓存
+func (dh *Datahub) MatchGroupTagExpr(group string, expr *tagexpr.Expr, name string) bool {
+	group = strings.ToUpper(group)
+	name = netutils.NormalizeDomain(name)
+	key := exprCachePrefix + group + "|" + expr.String() + "|" + name
+	dh.refreshSchedules()
+	return dh.matchCache.lookup(matchCacheGlobal, key, func() string {
+		return exprResult(expr.Eval(func(tag string) bool {
+			return dh.MixMatch(dh.resolveGroupTag(group, tag), name)
+		}))
+	}) != ""
+}
+
+// MatchTagExprNet 按标签表达式混合模式匹配网络地址
+func (dh *Datahub) MatchTagExprNet(expr *tagexpr.Expr, inet iplib.Net) bool {
+	return dh.matchTagExprNet(expr, inet, dh.MixMatchNet)
+}
+
+// matchTagExprNet 按标签表达式匹配网络地址, 单个标签由 match 匹配
+func (dh *Datahub) matchTagExprNet(expr *tagexpr.Expr, inet iplib.Net, match func(tag string, inet iplib.Net) bool) bool {
+	key := exprNetCachePrefix + expr.String() + "|" + inet.String()
+	dh.refreshSchedules()
+	return dh.matchCache.lookup(matchCacheGlobal, key, func() string {
+		return exprResult(expr.Eval(func(tag string) bool {
+			return match(strings.ToUpper(tag), inet)
+		}))
+	}) != ""
+}
+
+// exprResult 表达式求值结果转换为缓存的匹配器, 未命中为空
+func exprResult(ok bool) string {
+	if ok {
+		return exprMatcher
+	}
+	return ""
+}
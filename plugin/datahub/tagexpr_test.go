@@ -0,0 +1,85 @@
+package datahub
+
+import (
+	"testing"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+)
+
+func TestDatahub_MatchTagExpr(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "cn", "cn domain cn\ncn domain baidu.com\ncn domain ads.cn\n")
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "ads", "ads domain ads.cn\nads domain doubleclick.net\n")
+	loadTestTable(t, dh, datatable.DateTypeKeywordTable, "google", "google google\n")
+	tests := []struct {
+		expr string
+		name string
+		want bool
+	}{
+		{"cn & !ads", "www.baidu.com", true},
+		{"cn & !ads", "x.ads.cn", false},
+		{"(google | ads) & !cn", "www.google.com", true},
+		{"(google | ads) & !cn", "www.google.cn", false},
+		{"cn,google", "www.google.com", true},
+		{"!cn", "www.doubleclick.net", true},
+	}
+	for _, tc := range tests {
+		expr, err := CompileTagExpr(tc.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 第二次匹配命中缓存
+		for i := 0; i < 2; i++ {
+			if got := dh.MatchTagExpr(expr, tc.name); got != tc.want {
+				t.Errorf("MatchTagExpr(%q, %s) = %v, want %v", tc.expr, tc.name, got, tc.want)
+			}
+		}
+		if got := dh.MixMatchExpr(tc.expr, tc.name); got != tc.want {
+			t.Errorf("MixMatchExpr(%q, %s) = %v, want %v", tc.expr, tc.name, got, tc.want)
+		}
+	}
+	if dh.MixMatchExpr("cn &", "www.baidu.com") {
+		t.Error("invalid expression should not match")
+	}
+}
+
+func TestDatahub_MatchTagExprNet(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "private", "private 10.0.0.0/8\n")
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "office", "office 10.1.0.0/16\n")
+	expr, err := CompileTagExpr("private & !office")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{"10.2.0.1": true, "10.1.0.1": false, "8.8.8.8": false} {
+		inet, _ := netutils.ParseIpNet(ip)
+		if got := dh.MatchTagExprNet(expr, inet); got != want {
+			t.Errorf("MatchTagExprNet(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func Test_newRouteExpr(t *testing.T) {
+	tests := map[string]string{
+		"!cn,google":      "!(CN | GOOGLE)",
+		"cn & !ads":       "CN & !ADS",
+		"!cn | google":    "!CN | GOOGLE",
+		"geolocation-!cn": "GEOLOCATION-!CN",
+		"google@ads":      "GOOGLE@ADS",
+		"!google@!ads,cn": "!(GOOGLE@!ADS | CN)",
+		"(cn|apple)&!ads": "(CN | APPLE) & !ADS",
+	}
+	for tags, want := range tests {
+		rt, err := newRoute(tags, []string{"127.0.0.1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rt.expr.String(); got != want {
+			t.Errorf("newRoute(%q) expr %s, want %s", tags, got, want)
+		}
+	}
+	if _, err := newRoute("cn &", []string{"127.0.0.1"}); err == nil {
+		t.Error("expected error for bad expression")
+	}
+}
@@ -0,0 +1,201 @@
+package datahub
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/c-robinson/iplib"
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+)
+
+// tagIndex 全部全局标签的合并索引, 一次遍历得到名称或地址所属的全部标签.
+// 索引记录构建前的全局代际, 任一数据表重新加载后由后台任务重建并整体替换
+type tagIndex struct {
+	gen        uint64
+	tags       []string // 位序对应的标签, 已排序
+	domains    *netutils.DomainTagIndex
+	excepts    *netutils.DomainTagIndex
+	importants *netutils.DomainTagIndex // 不被例外规则覆盖的规则
+	nets       *netutils.NetTagIndex
+	asns       map[uint32]netutils.TagSet // 网络地址表中的 AS 编号
+}
+
+// tagIndexHolder 发布当前的标签索引, 查询只读取已发布的索引, 不参与构建
+type tagIndexHolder struct {
+	index    atomic.Value // *tagIndex
+	building int32        // 后台重建任务是否在运行
+}
+
+// emptyTagIndex 首次构建完成前使用的空索引
+var emptyTagIndex = newTagIndex(0, nil).build()
+
+func newTagIndex(gen uint64, tags []string) *tagIndex {
+	return &tagIndex{
+		gen:        gen,
+		tags:       tags,
+		domains:    netutils.NewDomainTagIndex(),
+		excepts:    netutils.NewDomainTagIndex(),
+		importants: netutils.NewDomainTagIndex(),
+		nets:       netutils.NewNetTagIndex(),
+		asns:       make(map[uint32]netutils.TagSet),
+	}
+}
+
+// build 编译域名索引, 返回自身
+func (x *tagIndex) build() *tagIndex {
+	x.domains.Build()
+	x.excepts.Build()
+	x.importants.Build()
+	return x
+}
+
+// getTagIndex 返回已发布的标签索引, 代际过期时触发后台重建, 重建完成前继续使用旧索引
+func (dh *Datahub) getTagIndex() *tagIndex {
+	x, _ := dh.tagIndex.index.Load().(*tagIndex)
+	if x == nil || x.gen != dh.matchCache.generation(matchCacheGlobal) {
+		dh.rebuildTagIndex()
+	}
+	if x == nil {
+		return emptyTagIndex
+	}
+	return x
+}
+
+// rebuildTagIndex 启动后台重建任务, 同一时间只运行一个任务, 构建期间代际再次变化时继续重建
+func (dh *Datahub) rebuildTagIndex() {
+	if !atomic.CompareAndSwapInt32(&dh.tagIndex.building, 0, 1) {
+		return
+	}
+	go func() {
+		for {
+			gen := dh.matchCache.generation(matchCacheGlobal)
+			dh.tagIndex.index.Store(dh.buildTagIndex(gen))
+			atomic.StoreInt32(&dh.tagIndex.building, 0)
+			if gen == dh.matchCache.generation(matchCacheGlobal) ||
+				!atomic.CompareAndSwapInt32(&dh.tagIndex.building, 0, 1) {
+				return
+			}
+		}
+	}()
+}
+
+// buildTagIndex 汇总域名表, 关键词表, geosite, 网络地址表与 geoip 的规则, 分组标签不参与
+func (dh *Datahub) buildTagIndex(gen uint64) *tagIndex {
+	keys := dh.domainTableMap.Keys()
+	keys = append(keys, dh.keywordTableMap.Keys()...)
+	keys = append(keys, dh.netlistTableMap.Keys()...)
+	dh.geodlmLock.RLock()
+	for k := range dh.geositeDoaminListMap {
+		keys = append(keys, k)
+	}
+	dh.geodlmLock.RUnlock()
+	dh.geonlmLock.RLock()
+	for k := range dh.geoipNetListMap {
+		keys = append(keys, k)
+	}
+	dh.geonlmLock.RUnlock()
+
+	x := newTagIndex(gen, groupKeys("", keys))
+	for i, tag := range x.tags {
+		i := i
+		addRule := func(matchType string, name string) { x.domains.Add(i, matchType, name) }
+		addExcept := func(matchType string, name string) { x.excepts.Add(i, matchType, name) }
+		addImportant := func(matchType string, name string) { x.importants.Add(i, matchType, name) }
+		if list := dh.getDataTableByTag(datatable.DateTypeDomainlistTable, tag); list != nil {
+			data := list.GetData().(*datatable.DomainData)
+			data.ForEachRule(addRule)
+			data.ForEachException(addExcept)
+			data.ForEachImportant(addImportant)
+		}
+		if list := dh.getDataTableByTag(datatable.DateTypeKeywordTable, tag); list != nil {
+			data := list.GetData().(*datatable.KeywordData)
+			for _, word := range data.Keywords() {
+				addRule(netutils.MatchKeywordType, word)
+			}
+			for _, word := range data.ExceptKeywords() {
+				addExcept(netutils.MatchKeywordType, word)
+			}
+		}
+		if list := dh.getGeoDomainListByTag(tag); list != nil {
+			list.ForEachRule(addRule, 0)
+		}
+		if list := dh.getDataTableByTag(datatable.DateTypeNetlistTable, tag); list != nil {
+			data := list.GetData().(*datatable.NetlistData)
+			data.ForEach(func(item interface{}) error {
+				if inet, ok := item.(iplib.Net); ok {
+					x.nets.Add(i, inet)
+				}
+				return nil
+			}, 0)
+			for _, asn := range data.ASNs() {
+				tags := x.asns[asn]
+				tags.Add(i)
+				x.asns[asn] = tags
+			}
+		}
+		if list := dh.getGeoNetListByTag(tag); list != nil {
+			list.ForEach(func(inet iplib.Net) { x.nets.Add(i, inet) }, 0)
+		}
+	}
+	return x.build()
+}
+
+func (x *tagIndex) names(set netutils.TagSet) []string {
+	tags := make([]string, 0)
+	set.ForEach(func(i int) {
+		tags = append(tags, x.tags[i])
+	})
+	return tags
+}
+
+// TagsOf 返回域名所属的全部标签, 已排除命中例外规则的标签(important 规则除外), 结果已排序
+func (dh *Datahub) TagsOf(name string) []string {
+	name = netutils.NormalizeDomain(name)
+	x := dh.getTagIndex()
+	set := x.domains.Match(name)
+	if !set.Empty() {
+		set.AndNot(x.excepts.Match(name))
+	}
+	set.Or(x.importants.Match(name))
+	return dh.activeTags(x.names(set))
+}
+
+// TagsOfIP 返回地址或网段所属的全部标签, 结果已排序
+func (dh *Datahub) TagsOfIP(ip string) []string {
+	inet, err := netutils.ParseIpNet(strings.TrimSpace(ip))
+	if err != nil {
+		return []string{}
+	}
+	return dh.TagsOfNet(inet)
+}
+
+// TagsOfNet 返回包含网段 inet 的全部标签, 结果已排序
+func (dh *Datahub) TagsOfNet(inet iplib.Net) []string {
+	x := dh.getTagIndex()
+	set := x.nets.Match(inet)
+	if len(x.asns) > 0 {
+		if info := dh.lookupASNNet(inet); info != nil {
+			set.Or(x.asns[info.ASN])
+		}
+	}
+	tags := x.names(set)
+	if record, _ := dh.lookupGeoipMmdb(inet); record != nil && len(record.Tags()) > 0 {
+		tags = sortedKeys(append(tags, record.Tags()...))
+	}
+	return dh.activeTags(tags)
+}
+
+// activeTags 去掉不在生效时间窗口内的标签
+func (dh *Datahub) activeTags(tags []string) []string {
+	if len(dh.schedules) == 0 {
+		return tags
+	}
+	active := tags[:0]
+	for _, tag := range tags {
+		if dh.tagActive(tag) {
+			active = append(active, tag)
+		}
+	}
+	return active
+}
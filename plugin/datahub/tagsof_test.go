@@ -0,0 +1,71 @@
+package datahub
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ca17/datahub/plugin/pkg/datatable"
+)
+
+// waitTagIndex 等待后台任务发布当前代际的标签索引
+func waitTagIndex(t *testing.T, dh *Datahub) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for dh.getTagIndex().gen != dh.matchCache.generation(matchCacheGlobal) {
+		if time.Now().After(deadline) {
+			t.Fatal("tag index not rebuilt")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDatahub_TagsOf(t *testing.T) {
+	dh := NewDatahub()
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "ads", "ads domain example.com\nads except cdn.example.com\n")
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "cn", "cn domain cn\ncn full www.example.com\n")
+	loadTestTable(t, dh, datatable.DateTypeKeywordTable, "track", "track tracker\n")
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "lan", "lan 10.0.0.0/8\nlan fd00::/8\n")
+	loadTestTable(t, dh, datatable.DateTypeNetlistTable, "office", "office 10.1.0.0/16\n")
+	waitTagIndex(t, dh)
+
+	cases := []struct {
+		name string
+		tags []string
+	}{
+		{"WWW.Example.com.", []string{"ADS", "CN"}},
+		{"tracker.example.com", []string{"ADS", "TRACK"}},
+		{"cdn.example.com", []string{}},
+		{"baidu.cn", []string{"CN"}},
+	}
+	for _, c := range cases {
+		if tags := dh.TagsOf(c.name); !reflect.DeepEqual(tags, c.tags) {
+			t.Errorf("TagsOf(%s) = %v, want %v", c.name, tags, c.tags)
+		}
+		matched := make(map[string]bool)
+		for _, tag := range c.tags {
+			matched[tag] = true
+		}
+		for _, tag := range []string{"ADS", "CN", "TRACK"} {
+			if dh.MixMatch(tag, c.name) != matched[tag] {
+				t.Errorf("TagsOf(%s) disagrees with MixMatch(%s)", c.name, tag)
+			}
+		}
+	}
+	if tags := dh.TagsOfIP("10.1.2.3"); !reflect.DeepEqual(tags, []string{"LAN", "OFFICE"}) {
+		t.Errorf("TagsOfIP(10.1.2.3) = %v", tags)
+	}
+	if tags := dh.TagsOfIP("fd00::1"); !reflect.DeepEqual(tags, []string{"LAN"}) {
+		t.Errorf("TagsOfIP(fd00::1) = %v", tags)
+	}
+	if tags := dh.TagsOfIP("bad"); len(tags) != 0 {
+		t.Errorf("TagsOfIP(bad) = %v", tags)
+	}
+
+	// 数据表重新加载后索引重建
+	loadTestTable(t, dh, datatable.DateTypeDomainlistTable, "cn", "cn domain cn\n")
+	waitTagIndex(t, dh)
+	if tags := dh.TagsOf("www.example.com"); !reflect.DeepEqual(tags, []string{"ADS"}) {
+		t.Errorf("TagsOf after reload = %v", tags)
+	}
+}
@@ -0,0 +1,167 @@
+package datatable
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+)
+
+// 域名表格式, auto 按行识别 Adblock Plus 规则, 其余行按原有格式解析
+const (
+	DomainFormatAuto   = "auto"
+	DomainFormatNative = "native"
+	DomainFormatAbp    = "abp"
+
+	maxUnsupportedSamples = 20
+)
+
+// abpOptions DNS 层面可以执行的规则选项, 其他选项(如 $script, $domain=)依赖请求上下文, 视为不支持.
+// important 规则不能被例外规则覆盖, 单独存储
+var abpOptions = map[string]bool{
+	"important": true,
+	"all":       true,
+	"document":  true,
+	"doc":       true,
+}
+
+// IsDomainFormat 判断是否为支持的域名表格式
+func IsDomainFormat(format string) bool {
+	switch format {
+	case DomainFormatAuto, DomainFormatNative, DomainFormatAbp:
+		return true
+	}
+	return false
+}
+
+// isAbpLine 判断单行是否为 Adblock Plus 语法, 原有格式为空白分隔的多个字段或单个域名
+func isAbpLine(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.ContainsAny(line, " \t") {
+		return false
+	}
+	switch line[0] {
+	case '!', '|', '[', '/':
+		return true
+	}
+	return strings.HasPrefix(line, ExceptPrefix+"|") || strings.ContainsAny(line, "^$") ||
+		strings.Contains(line, "##") || strings.Contains(line, "#@#")
+}
+
+// parseAbpRule 将 Adblock Plus 网络规则转换为域名规则, 注释与空行返回空的 mtype.
+//
+//	||example.com^        后缀匹配 example.com
+//	|example.com^         完整匹配 example.com, 可带 http:// 等协议前缀
+//	example.com           后缀匹配, 同原有格式
+//	||ad*.example.com^    含通配符时转换为正则
+//	/^ads?[0-9]*\./       正则
+//	@@||example.com^      例外规则
+//	||example.com^$important  不被例外规则覆盖
+//	$document 等选项      仅支持 important, all, document
+//
+// 元素隐藏规则, 带路径的规则及依赖请求上下文的选项返回错误
+func parseAbpRule(rule string) (mtype string, value string, except bool, important bool, err error) {
+	rule = strings.TrimSpace(rule)
+	if rule == "" || rule[0] == '!' || rule[0] == '[' || strings.HasPrefix(rule, "# ") || rule == "#" {
+		return "", "", false, false, nil
+	}
+	if strings.Contains(rule, "##") || strings.Contains(rule, "#@#") ||
+		strings.Contains(rule, "#?#") || strings.Contains(rule, "#$#") {
+		return "", "", false, false, fmt.Errorf("cosmetic rule")
+	}
+	if strings.HasPrefix(rule, ExceptPrefix) {
+		except, rule = true, rule[len(ExceptPrefix):]
+	}
+
+	pattern, options := rule, ""
+	if strings.HasPrefix(rule, "/") && strings.LastIndexByte(rule, '/') > 0 {
+		i := strings.LastIndexByte(rule, '/')
+		pattern = rule[:i+1]
+		if rest := rule[i+1:]; rest != "" {
+			if rest[0] != '$' {
+				return "", "", except, false, fmt.Errorf("path rule")
+			}
+			options = rest[1:]
+		}
+	} else if i := strings.LastIndexByte(rule, '$'); i >= 0 {
+		pattern, options = rule[:i], rule[i+1:]
+	}
+	for _, opt := range strings.Split(options, ",") {
+		opt = strings.ToLower(strings.TrimSpace(opt))
+		if opt != "" && !abpOptions[opt] {
+			return "", "", except, false, fmt.Errorf("unsupported option $%s", opt)
+		}
+		if opt == "important" && !except {
+			important = true
+		}
+	}
+
+	if len(pattern) > 2 && pattern[0] == '/' && pattern[len(pattern)-1] == '/' {
+		expr := pattern[1 : len(pattern)-1]
+		if _, err := regexp.Compile(expr); err != nil {
+			return "", "", except, false, fmt.Errorf("regex error %s", err.Error())
+		}
+		return netutils.MatchRegexType, expr, except, important, nil
+	}
+	switch {
+	case strings.HasPrefix(pattern, "||"):
+		mtype, value, err = abpHostRule(pattern[2:], netutils.MatchDomainType, `(^|\.)`)
+	case strings.HasPrefix(pattern, "|"):
+		pattern = pattern[1:]
+		if i := strings.Index(pattern, "://"); i >= 0 {
+			pattern = pattern[i+3:]
+		}
+		mtype, value, err = abpHostRule(pattern, netutils.MatchFullType, `^`)
+	default:
+		mtype, value, err = abpHostRule(pattern, netutils.MatchDomainType, ``)
+	}
+	return mtype, value, except, important, err
+}
+
+// abpHostRule 转换主机名模式, 无通配符时返回 mtype 规则, 否则转换为以 anchor 开头的正则
+func abpHostRule(pattern string, mtype string, anchor string) (string, string, error) {
+	pattern = strings.ToLower(pattern)
+	end := false
+	for len(pattern) > 0 && strings.IndexByte("^|/", pattern[len(pattern)-1]) >= 0 {
+		pattern, end = pattern[:len(pattern)-1], true
+	}
+	pattern = normalizeAbpHost(pattern)
+	wildcard := false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*':
+			wildcard = true
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '.', c == '_':
+		default:
+			return "", "", fmt.Errorf("path rule")
+		}
+	}
+	if strings.Trim(pattern, "*.") == "" {
+		return "", "", fmt.Errorf("empty host pattern")
+	}
+	if !wildcard {
+		return mtype, pattern, nil
+	}
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	expr := anchor + strings.Join(parts, ".*")
+	if end {
+		expr += "$"
+	}
+	return netutils.MatchRegexType, expr, nil
+}
+
+// normalizeAbpHost 将国际化域名标签转换为 punycode, 与查询域名的规范化结果一致,
+// 含通配符的标签保持原样
+func normalizeAbpHost(pattern string) string {
+	labels := strings.Split(pattern, ".")
+	for i, label := range labels {
+		if label != "" && !strings.Contains(label, "*") {
+			labels[i] = netutils.NormalizeDomain(label)
+		}
+	}
+	return strings.Join(labels, ".")
+}
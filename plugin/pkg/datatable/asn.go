@@ -0,0 +1,306 @@
+package datatable
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/c-robinson/iplib"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+)
+
+// ASNInfo 自治系统信息, Range 为命中的地址段
+type ASNInfo struct {
+	ASN     uint32 `json:"asn"`
+	Country string `json:"country,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Range   string `json:"range,omitempty"`
+}
+
+type asnRange struct {
+	start [16]byte
+	end   [16]byte
+	asn   uint32
+}
+
+func (r asnRange) String() string {
+	return rangeIP(r.start).String() + "-" + rangeIP(r.end).String()
+}
+
+// AsnData ip2asn 地址段表, 按起始地址排序, 地址段之间不重叠.
+// 支持以下格式, 字段以 Tab, 逗号或空白分隔, 无法解析的行(如 CSV 表头)忽略:
+//
+//	range_start range_end AS_number [country_code] [AS_description]  (iptoasn.com, 地址可为 IPv4 整数形式)
+//	network AS_number [AS_organization]                               (GeoLite2-ASN-Blocks)
+type AsnData struct {
+	sync.RWMutex
+	tag    string
+	ranges []asnRange
+	infos  map[uint32]*ASNInfo
+}
+
+func newAsnData(tag string) *AsnData {
+	return &AsnData{tag: tag, infos: make(map[uint32]*ASNInfo)}
+}
+
+// ParseASN 解析 AS13335 或 13335 形式的自治系统编号
+func ParseASN(s string) (uint32, bool) {
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	return uint32(n), true
+}
+
+func (a *AsnData) Reset() {
+	a.Lock()
+	defer a.Unlock()
+	a.ranges = nil
+	a.infos = make(map[uint32]*ASNInfo)
+}
+
+// ParseFile 离线构建新表后整体替换
+func (a *AsnData) ParseFile(r io.Reader) error {
+	ranges, infos := make([]asnRange, 0), make(map[uint32]*ASNInfo)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		ranges = parseAsnLine(ranges, infos, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	a.swap(ranges, infos)
+	return nil
+}
+
+func (a *AsnData) ParseLines(lines []string, reset bool) {
+	var ranges []asnRange
+	infos := make(map[uint32]*ASNInfo)
+	if !reset {
+		a.RLock()
+		ranges = append(ranges, a.ranges...)
+		for k, v := range a.infos {
+			infos[k] = v
+		}
+		a.RUnlock()
+	}
+	for _, line := range lines {
+		ranges = parseAsnLine(ranges, infos, line)
+	}
+	a.swap(ranges, infos)
+}
+
+func (a *AsnData) swap(ranges []asnRange, infos map[uint32]*ASNInfo) {
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].start[:], ranges[j].start[:]) < 0
+	})
+	a.Lock()
+	defer a.Unlock()
+	a.ranges, a.infos = ranges, infos
+}
+
+func parseAsnLine(ranges []asnRange, infos map[uint32]*ASNInfo, line string) []asnRange {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	line = strings.TrimSpace(line)
+	var fields []string
+	switch {
+	case line == "":
+		return ranges
+	case strings.Contains(line, "\t"):
+		fields = strings.Split(line, "\t")
+	case strings.Contains(line, ","):
+		r := csv.NewReader(strings.NewReader(line))
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		var err error
+		if fields, err = r.Read(); err != nil {
+			return ranges
+		}
+	default:
+		fields = strings.Fields(line)
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if len(fields) < 2 {
+		return ranges
+	}
+
+	var rg asnRange
+	var rest []string
+	if strings.Contains(fields[0], "/") {
+		inet, err := netutils.ParseIpNet(fields[0])
+		if err != nil {
+			return ranges
+		}
+		rg.start, rg.end = netRange(inet)
+		rest = fields[1:]
+	} else {
+		if len(fields) < 3 {
+			return ranges
+		}
+		start, ok1 := parseRangeIP(fields[0])
+		end, ok2 := parseRangeIP(fields[1])
+		if !ok1 || !ok2 || bytes.Compare(start[:], end[:]) > 0 {
+			return ranges
+		}
+		rg.start, rg.end = start, end
+		rest = fields[2:]
+	}
+	asn, ok := ParseASN(rest[0])
+	if !ok {
+		// ASN 0 表示未路由的地址段
+		return ranges
+	}
+	rg.asn = asn
+	if _, ok := infos[asn]; !ok {
+		info := &ASNInfo{ASN: asn}
+		switch {
+		case len(rest) >= 3:
+			info.Country, info.Name = rest[1], rest[2]
+		case len(rest) == 2:
+			info.Name = rest[1]
+		}
+		infos[asn] = info
+	}
+	return append(ranges, rg)
+}
+
+// parseRangeIP 解析 IP 地址或 IPv4 整数形式的地址
+func parseRangeIP(s string) ([16]byte, bool) {
+	if ip := net.ParseIP(s); ip != nil {
+		return rangeKey(ip), true
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return [16]byte{}, false
+	}
+	return rangeKey(net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))), true
+}
+
+// rangeKey 统一为 16 字节形式, IPv4 使用映射地址, 保证 IPv4 排在 IPv6 之前且不与之重叠
+func rangeKey(ip net.IP) [16]byte {
+	var k [16]byte
+	copy(k[:], ip.To16())
+	return k
+}
+
+// netRange 返回网段的首末地址, 含网络地址与广播地址
+func netRange(inet iplib.Net) (start, end [16]byte) {
+	ip, mask := netutils.NormalizeIP(inet.IP()), inet.Mask()
+	last := make(net.IP, len(ip))
+	for i := range ip {
+		last[i] = ip[i]
+		if i < len(mask) {
+			last[i] |= ^mask[i]
+		}
+	}
+	return rangeKey(ip), rangeKey(last)
+}
+
+func rangeIP(k [16]byte) net.IP {
+	return netutils.NormalizeIP(net.IP(k[:]))
+}
+
+// find 返回包含 [start, end] 的地址段, 调用方持有读锁
+func (a *AsnData) find(start, end [16]byte) (asnRange, bool) {
+	i := sort.Search(len(a.ranges), func(i int) bool {
+		return bytes.Compare(a.ranges[i].start[:], start[:]) > 0
+	})
+	if i == 0 {
+		return asnRange{}, false
+	}
+	r := a.ranges[i-1]
+	if bytes.Compare(end[:], r.end[:]) > 0 {
+		return asnRange{}, false
+	}
+	return r, true
+}
+
+// LookupNet 返回完整包含网段 inet 的自治系统信息, 未找到时返回 nil
+func (a *AsnData) LookupNet(inet iplib.Net) *ASNInfo {
+	start, end := netRange(inet)
+	a.RLock()
+	defer a.RUnlock()
+	r, ok := a.find(start, end)
+	if !ok {
+		return nil
+	}
+	info := *a.infos[r.asn]
+	info.Range = r.String()
+	return &info
+}
+
+// LookupIP 返回地址所属的自治系统信息, 未找到时返回 nil
+func (a *AsnData) LookupIP(ip net.IP) *ASNInfo {
+	if ip == nil {
+		return nil
+	}
+	return a.LookupNet(netutils.HostNet(ip))
+}
+
+// Match name 为地址时判断是否属于任一地址段, 为 AS 编号时判断表中是否存在该自治系统
+func (a *AsnData) Match(name string) bool {
+	if asn, ok := ParseASN(name); ok {
+		a.RLock()
+		defer a.RUnlock()
+		return a.infos[asn] != nil
+	}
+	inet, err := netutils.ParseIpNet(name)
+	if err != nil {
+		return false
+	}
+	return a.MatchNet(inet)
+}
+
+func (a *AsnData) MatchNet(inet iplib.Net) bool {
+	return a.LookupNet(inet) != nil
+}
+
+func (a *AsnData) ParseInline(ws []string) {
+	fmt.Println("AsnData.ParseInline no support")
+}
+
+func (a *AsnData) LessString() string {
+	sb := strings.Builder{}
+	sb.WriteString("AsnData(Top10):{")
+	items := make([]string, 0)
+	a.ForEach(func(item interface{}) error {
+		items = append(items, item.(string))
+		return nil
+	}, 10)
+	sb.WriteString(strings.Join(items, ","))
+	sb.WriteString("...}")
+	return sb.String()
+}
+
+func (a *AsnData) Len() int {
+	a.RLock()
+	defer a.RUnlock()
+	return len(a.ranges)
+}
+
+// ForEach 按地址顺序遍历地址段, 格式同 ip2asn TSV
+func (a *AsnData) ForEach(f func(interface{}) error, max int) {
+	a.RLock()
+	defer a.RUnlock()
+	for i, r := range a.ranges {
+		if max > 0 && i >= max {
+			return
+		}
+		info := a.infos[r.asn]
+		_ = f(fmt.Sprintf("%s\t%s\t%d\t%s\t%s", rangeIP(r.start), rangeIP(r.end), r.asn, info.Country, info.Name))
+	}
+}
@@ -22,6 +22,8 @@ const (
 	DateTypeNetlistTable    = "netlist_table"
 	DateTypeDomainlistTable = "domain_table"
 	DateTypeEcsTable        = "ecs_table"
+	DateTypeHostsTable      = "hosts_table"
+	DateTypeAsnTable        = "asn_table"
 )
 
 type TextData interface {
@@ -48,6 +50,7 @@ type DataTable struct {
 	jwtSecret   string
 	bootstrap   []string
 	rdata       TextData
+	onChange    func() // 数据变更后回调, 用于使匹配缓存失效
 }
 
 func NewFromArgs(datatype string, tag string, from string) *DataTable {
@@ -82,17 +85,26 @@ func NewDataTable(datatype string, tag string, wtype int, path, url string, inli
 		dt.rdata = newDomainData(tag)
 	case DateTypeEcsTable:
 		dt.rdata = NewEcsData(tag)
+	case DateTypeHostsTable:
+		dt.rdata = newHostsData(tag)
+	case DateTypeAsnTable:
+		dt.rdata = newAsnData(tag)
 	default:
 		return nil
 	}
 	if inline != "" && strings.HasPrefix(inline, tag) {
-		dt.rdata.ParseLines(strings.Fields(inline), false)
+		if datatype == DateTypeHostsTable {
+			dt.rdata.ParseInline(strings.Fields(inline))
+		} else {
+			dt.rdata.ParseLines(strings.Fields(inline), false)
+		}
 	}
 	return dt
 }
 
 func (kt *DataTable) Reset() {
 	kt.rdata.Reset()
+	kt.changed()
 }
 
 func (kt *DataTable) Match(name string) bool {
@@ -137,6 +149,7 @@ func (kt *DataTable) LoadFromFile() {
 	kt.mtime = stat.ModTime()
 	kt.size = stat.Size()
 	kt.Unlock()
+	kt.changed()
 }
 
 func (kt *DataTable) LoadFromUrl() {
@@ -172,6 +185,7 @@ func (kt *DataTable) LoadFromUrl() {
 	kt.Lock()
 	kt.contentHash = contentHash1
 	kt.Unlock()
+	kt.changed()
 }
 
 func (kt *DataTable) LoadFromInline(ws []string) {
@@ -179,8 +193,9 @@ func (kt *DataTable) LoadFromInline(ws []string) {
 		return
 	}
 	kt.Lock()
-	defer kt.Unlock()
 	kt.rdata.ParseInline(ws)
+	kt.Unlock()
+	kt.changed()
 }
 
 func (kt *DataTable) LoadAll() {
@@ -200,6 +215,23 @@ func (kt *DataTable) String() string {
 	return sb.String()
 }
 
+// Source 返回数据来源, 文件路径, 不含令牌的 URL 或 inline
+func (kt *DataTable) Source() string {
+	kt.RLock()
+	defer kt.RUnlock()
+	switch kt.whichType {
+	case WhichTypePath:
+		return kt.path
+	case WhichTypeUrl:
+		if i := strings.Index(kt.url, "token="); i > 0 {
+			return kt.url[:i-1]
+		}
+		return kt.url
+	default:
+		return "inline"
+	}
+}
+
 func (kt *DataTable) GetData() TextData {
 	return kt.rdata
 }
@@ -211,3 +243,19 @@ func (kt *DataTable) SetJwtSecret(s string) {
 func (kt *DataTable) SetBootstrap(bs []string) {
 	kt.bootstrap = bs
 }
+
+// SetOnChange 设置数据变更回调, 文件, URL 或行内数据重新加载后调用
+func (kt *DataTable) SetOnChange(f func()) {
+	kt.Lock()
+	defer kt.Unlock()
+	kt.onChange = f
+}
+
+func (kt *DataTable) changed() {
+	kt.RLock()
+	f := kt.onChange
+	kt.RUnlock()
+	if f != nil {
+		f()
+	}
+}
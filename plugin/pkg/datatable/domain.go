@@ -5,77 +5,261 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 
 	"github.com/c-robinson/iplib"
-	"github.com/metaslink/metasdns/plugin/pkg/netutils"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
 )
 
+// ExceptPrefix 例外规则前缀, 如 `@@ads.example.com`, `tag @@full name`
+const ExceptPrefix = "@@"
+
+// DomainData 域名表, 全部规则列表保存在一个 domainRules 中, 加载时整体替换
 type DomainData struct {
-	tag  string
-	data *netutils.DomainList
+	sync.RWMutex
+	tag    string
+	format string
+	rules  *domainRules // 发布后只读
+}
+
+// UnsupportedRules 无法转换的规则数量及前若干条示例
+type UnsupportedRules struct {
+	Count   int      `json:"count"`
+	Samples []string `json:"samples"`
+}
+
+func (u *UnsupportedRules) add(rule string, err error) {
+	u.Count++
+	if len(u.Samples) < maxUnsupportedSamples {
+		u.Samples = append(u.Samples, rule+" ("+err.Error()+")")
+	}
+}
+
+// domainRules 域名表的一组规则, 解析时构建, 发布后不再修改
+type domainRules struct {
+	list        *netutils.DomainList
+	except      *netutils.DomainList // 例外规则, 覆盖 list 的命中结果
+	important   *netutils.DomainList // Adblock Plus $important 规则, 不被例外规则覆盖
+	unsupported *UnsupportedRules    // 最近一次加载中无法转换的规则
+}
+
+func newDomainRules() *domainRules {
+	return &domainRules{
+		list:        netutils.NewDomainList(),
+		except:      netutils.NewDomainList(),
+		important:   netutils.NewDomainList(),
+		unsupported: &UnsupportedRules{Samples: []string{}},
+	}
 }
 
 func newDomainData(tag string) *DomainData {
-	return &DomainData{tag: tag, data: netutils.NewDomainList()}
+	return &DomainData{tag: tag, format: DomainFormatAuto, rules: newDomainRules()}
+}
+
+// SetFormat 设置表格式, 在加载数据之前调用
+func (d *DomainData) SetFormat(format string) {
+	d.Lock()
+	defer d.Unlock()
+	d.format = format
+}
+
+func (d *DomainData) getFormat() string {
+	d.RLock()
+	defer d.RUnlock()
+	return d.format
+}
+
+// Unsupported 返回最近一次加载中无法转换的规则
+func (d *DomainData) Unsupported() UnsupportedRules {
+	return *d.getRules().unsupported
+}
+
+// getRules 返回当前规则, 一次匹配只读取一次, 保证各列表来自同一次加载
+func (d *DomainData) getRules() *domainRules {
+	d.RLock()
+	defer d.RUnlock()
+	return d.rules
+}
+
+// cloneRules 复制当前规则, 追加规则时在副本上修改后整体替换, 避免修改正在匹配的列表
+func (d *DomainData) cloneRules() *domainRules {
+	rules := d.getRules()
+	u := *rules.unsupported
+	u.Samples = append([]string{}, u.Samples...)
+	return &domainRules{list: rules.list.Clone(), except: rules.except.Clone(), important: rules.important.Clone(), unsupported: &u}
+}
+
+func (d *DomainData) swap(rules *domainRules) {
+	d.Lock()
+	defer d.Unlock()
+	d.rules = rules
 }
 
 func (d *DomainData) Reset() {
-	d.data.Clear()
+	d.swap(newDomainRules())
 }
 
+// ParseFile 离线构建新列表后整体替换, 加载期间匹配不受影响
 func (d *DomainData) ParseFile(r io.Reader) error {
+	rules, format := newDomainRules(), d.getFormat()
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
-		line := scanner.Text()
-		d.parseline(line)
+		d.parseline(rules, format, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
 	}
+	d.swap(rules)
 	return nil
 }
 
 func (d *DomainData) ParseLines(lines []string, reset bool) {
-	if reset {
-		d.data.Clear()
+	format := d.getFormat()
+	rules := newDomainRules()
+	if !reset {
+		rules = d.cloneRules()
 	}
 	for _, line := range lines {
-		d.parseline(line)
+		d.parseline(rules, format, line)
 	}
+	d.swap(rules)
 }
 
-func (d *DomainData) parseline(line string) {
+// parseline 按表格式解析一行规则
+func (d *DomainData) parseline(rules *domainRules, format string, line string) {
+	switch format {
+	case DomainFormatAbp:
+		d.parseAbpLine(rules, line)
+	case DomainFormatNative:
+		d.parseNativeLine(rules.list, rules.except, line)
+	default:
+		if isAbpLine(line) {
+			d.parseAbpLine(rules, line)
+		} else {
+			d.parseNativeLine(rules.list, rules.except, line)
+		}
+	}
+}
+
+// parseAbpLine 解析 Adblock Plus 规则, 无法转换的规则记入 unsupported
+func (d *DomainData) parseAbpLine(rules *domainRules, line string) {
+	mtype, value, except, important, err := parseAbpRule(line)
+	switch {
+	case err != nil:
+		rules.unsupported.add(strings.TrimSpace(line), err)
+	case mtype == "":
+	case except:
+		rules.except.Add(mtype, value)
+	case important:
+		rules.important.Add(mtype, value)
+	default:
+		rules.list.Add(mtype, value)
+	}
+}
+
+// parseNativeLine 解析一行规则, 无标签的单个域名按后缀匹配处理.
+// 例外规则写作 `@@name`, `tag except name` 或 `tag @@full|@@domain|@@regex name`
+func (d *DomainData) parseNativeLine(list, except *netutils.DomainList, line string) {
 	if i := strings.IndexByte(line, '#'); i >= 0 {
 		line = line[:i]
 	}
 	attrs := strings.Fields(line)
 	if len(attrs) == 1 {
-		d.data.Add(netutils.MatchFullType, line)
+		addDomainRule(list, except, netutils.MatchDomainType, attrs[0])
 		return
 	}
-	if len(attrs) < 3 {
+	if len(attrs) < 3 || d.tag != strings.ToUpper(attrs[0]) {
 		return
 	}
-	if attrs[1] != netutils.MatchFullType &&
-		attrs[1] != netutils.MatchDomainType &&
-		attrs[1] != netutils.MatchRegexType {
+	mtype := attrs[1]
+	if mtype == netutils.MatchExceptType {
+		except.Add(netutils.MatchDomainType, attrs[2])
 		return
 	}
-	if d.tag == strings.ToUpper(attrs[0]) {
-		d.data.Add(attrs[1], attrs[2])
+	target := list
+	if strings.HasPrefix(mtype, ExceptPrefix) {
+		target, mtype = except, mtype[len(ExceptPrefix):]
+	}
+	switch mtype {
+	case netutils.MatchFullType, netutils.MatchDomainType, netutils.MatchRegexType:
+		target.Add(mtype, attrs[2])
 	}
 }
 
+// addDomainRule 添加规则, 以 ExceptPrefix 开头的规则加入例外列表
+func addDomainRule(list, except *netutils.DomainList, mtype string, name string) {
+	if strings.HasPrefix(name, ExceptPrefix) {
+		except.Add(mtype, name[len(ExceptPrefix):])
+		return
+	}
+	list.Add(mtype, name)
+}
+
 func (d *DomainData) ParseInline(ws []string) {
 	if len(ws) < 2 {
 		fmt.Println("inline len must > 2, format is  tag word...")
 		return
 	}
 	d.tag = ws[0]
+	rules := d.cloneRules()
 	for _, s := range ws[1:] {
-		d.data.Add(netutils.MatchFullType, s)
+		addDomainRule(rules.list, rules.except, netutils.MatchDomainType, s)
 	}
+	d.swap(rules)
 }
 
+// Match 命中 important 规则, 或命中规则且未命中例外规则
 func (d *DomainData) Match(name string) bool {
-	return d.data.MixMatch(name)
+	rules := d.getRules()
+	return rules.important.MixMatch(name) || rules.list.MixMatch(name) && !rules.except.MixMatch(name)
+}
+
+// Lookup 返回命中的规则及其匹配类型, important 规则优先, 不检查例外规则
+func (d *DomainData) Lookup(name string) (string, string, bool) {
+	rules := d.getRules()
+	if mtype, rule, ok := rules.important.Lookup(name); ok {
+		return mtype, rule, ok
+	}
+	return rules.list.Lookup(name)
+}
+
+// MatchImportant 命中 important 规则, 此时例外规则不生效, 不计入正则命中次数
+func (d *DomainData) MatchImportant(name string) bool {
+	_, _, ok := d.getRules().important.Lookup(name)
+	return ok
+}
+
+// LookupException 返回命中的例外规则及其匹配类型
+func (d *DomainData) LookupException(name string) (string, string, bool) {
+	return d.getRules().except.Lookup(name)
+}
+
+// ForEachRule 遍历规则及其匹配类型, 不含 important 规则
+func (d *DomainData) ForEachRule(f func(matchType string, name string)) {
+	d.getRules().list.ForEachRule(f, 0)
+}
+
+// ForEachImportant 遍历 important 规则及其匹配类型
+func (d *DomainData) ForEachImportant(f func(matchType string, name string)) {
+	d.getRules().important.ForEachRule(f, 0)
+}
+
+// ForEachException 遍历例外规则及其匹配类型
+func (d *DomainData) ForEachException(f func(matchType string, name string)) {
+	d.getRules().except.ForEachRule(f, 0)
+}
+
+// ExceptLen 例外规则数量
+func (d *DomainData) ExceptLen() int {
+	except := d.getRules().except
+	return except.FullLen() + except.RegexLen()
+}
+
+// RegexHits 遍历正则规则及其命中次数
+func (d *DomainData) RegexHits(f func(expr string, hits uint64)) {
+	rules := d.getRules()
+	rules.important.RegexHits(f)
+	rules.list.RegexHits(f)
 }
 
 func (d *DomainData) MatchNet(inet iplib.Net) bool {
@@ -86,7 +270,7 @@ func (d *DomainData) LessString() string {
 	sb := strings.Builder{}
 	sb.WriteString("NetlistData(Top10):{")
 	items := make([]string, 0)
-	d.data.ForEach(func(name string) {
+	d.getRules().list.ForEach(func(name string) {
 		items = append(items, name)
 	}, 10)
 	sb.WriteString(strings.Join(items, ","))
@@ -95,11 +279,24 @@ func (d *DomainData) LessString() string {
 }
 
 func (d *DomainData) Len() int {
-	return d.data.FullLen() + d.data.RegexLen()
+	rules := d.getRules()
+	return rules.list.FullLen() + rules.list.RegexLen() + rules.important.FullLen() + rules.important.RegexLen()
 }
 
 func (d *DomainData) ForEach(f func(interface{}) error, max int) {
-	d.data.ForEach(func(name string) {
+	rules := d.getRules()
+	c := 0
+	rules.important.ForEach(func(name string) {
+		_ = f(name)
+		c++
+	}, max)
+	if max > 0 && c >= max {
+		return
+	}
+	if max > 0 {
+		max -= c
+	}
+	rules.list.ForEach(func(name string) {
 		_ = f(name)
 	}, max)
 }
@@ -11,7 +11,7 @@ import (
 
 	"github.com/allegro/bigcache"
 	"github.com/c-robinson/iplib"
-	"github.com/metaslink/metasdns/plugin/pkg/netutils"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
 )
 
 type EcsData struct {
@@ -23,7 +23,7 @@ type EcsData struct {
 
 func NewEcsData(tag string) *EcsData {
 	_c, _ := bigcache.NewBigCache(bigcache.DefaultConfig(time.Hour * 24 * 3650))
-	return &EcsData{tag: tag, data: _c, netBindings: netutils.NewNetList(make([]iplib.Net, 0))}
+	return &EcsData{tag: tag, data: _c, netBindings: netutils.NewBindingNetList(nil)}
 }
 
 func (e *EcsData) Reset() {
@@ -33,24 +33,17 @@ func (e *EcsData) Reset() {
 	e.netBindings.Clear()
 }
 
+// MatchEcsIP 查询客户端 IP 绑定的 ECS 地址, 先精确匹配地址再匹配最具体的网段
 func (e *EcsData) MatchEcsIP(q string) net.IP {
-	r, err := e.data.Get(q)
+	ip := net.ParseIP(q)
+	if ip == nil {
+		return nil
+	}
+	r, err := e.data.Get(netutils.NormalizeIP(ip).String())
 	if err == nil {
 		return r
 	}
-	qnet, err := netutils.ParseIpNet(q)
-	if err != nil {
-		return nil
-	}
-	// iter := e.data.Iterator()
-	// for iter.SetNext() {
-	// 	v, err := iter.Value()
-	// 	if err != nil {
-	// 		fmt.Println(err)
-	// 	}
-	// 	fmt.Println(v)
-	// }
-	if n := e.netBindings.FindNet(qnet); n != nil {
+	if n := e.netBindings.FindNet(netutils.HostNet(ip)); n != nil {
 		r, err := e.data.Get(n.String())
 		if err == nil {
 			return r
@@ -100,6 +93,7 @@ func (e *EcsData) parseLine(line string) {
 	if ecsip == nil {
 		return
 	}
+	ecsip = netutils.NormalizeIP(ecsip)
 
 	var addrs = attrs[1]
 	var clist []string
@@ -120,8 +114,8 @@ func (e *EcsData) parseLine(line string) {
 				continue
 			}
 			e.netBindings.Add(inet)
-		} else {
-			_ = e.data.Set(c, ecsip)
+		} else if ip := net.ParseIP(c); ip != nil {
+			_ = e.data.Set(netutils.NormalizeIP(ip).String(), ecsip)
 		}
 	}
 }
@@ -131,6 +125,9 @@ func (e *EcsData) ParseInline(ws []string) {
 }
 
 func (e *EcsData) Match(name string) bool {
+	if ip := net.ParseIP(name); ip != nil {
+		name = netutils.NormalizeIP(ip).String()
+	}
 	_, err := e.data.Get(name)
 	if err != nil {
 		return false
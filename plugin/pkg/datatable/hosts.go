@@ -0,0 +1,255 @@
+package datatable
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/c-robinson/iplib"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
+	"github.com/miekg/dns"
+)
+
+const (
+	hostsDefaultTTL = 3600
+	hostsMaxChase   = 8
+)
+
+// HostsData 本地应答表, 支持 hosts 文件格式 `ip name...` 与记录格式 `name type value [ttl]`
+type HostsData struct {
+	sync.RWMutex
+	tag      string
+	records  map[string][]dns.RR
+	wildcard map[string][]dns.RR
+	count    int
+}
+
+func newHostsData(tag string) *HostsData {
+	return &HostsData{tag: tag, records: make(map[string][]dns.RR), wildcard: make(map[string][]dns.RR)}
+}
+
+func (h *HostsData) Reset() {
+	h.Lock()
+	defer h.Unlock()
+	h.records = make(map[string][]dns.RR)
+	h.wildcard = make(map[string][]dns.RR)
+	h.count = 0
+}
+
+func (h *HostsData) ParseFile(r io.Reader) error {
+	nh := newHostsData(h.tag)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		nh.parseline(scanner.Text())
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.records, h.wildcard, h.count = nh.records, nh.wildcard, nh.count
+	return nil
+}
+
+func (h *HostsData) ParseLines(lines []string, reset bool) {
+	if reset {
+		nh := newHostsData(h.tag)
+		for _, line := range lines {
+			nh.parseline(line)
+		}
+		h.Lock()
+		defer h.Unlock()
+		h.records, h.wildcard, h.count = nh.records, nh.wildcard, nh.count
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	for _, line := range lines {
+		h.parseline(line)
+	}
+}
+
+// ParseInline 格式为 tag ip name... 或 tag name type value [ttl]
+func (h *HostsData) ParseInline(ws []string) {
+	if len(ws) < 3 {
+		fmt.Println("inline len must > 3, format is  tag ip name...")
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.tag = strings.ToUpper(ws[0])
+	h.parseline(strings.Join(ws[1:], " "))
+}
+
+func (h *HostsData) parseline(line string) {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	attrs := strings.Fields(line)
+	if len(attrs) < 2 {
+		return
+	}
+	if ip := net.ParseIP(attrs[0]); ip != nil {
+		for _, name := range attrs[1:] {
+			h.addRecord(name, hostsAddrRR(name, ip, hostsDefaultTTL))
+		}
+		return
+	}
+	if len(attrs) >= 3 {
+		if _, ok := dns.StringToType[strings.ToUpper(attrs[1])]; ok {
+			h.parseRecord(attrs)
+			return
+		}
+	}
+	if h.tag == strings.ToUpper(attrs[0]) {
+		h.parseline(strings.Join(attrs[1:], " "))
+	}
+}
+
+// parseRecord 解析 `name type value [ttl]`
+func (h *HostsData) parseRecord(attrs []string) {
+	name, qtype, values := attrs[0], strings.ToUpper(attrs[1]), attrs[2:]
+	ttl := uint32(hostsDefaultTTL)
+	if len(values) > 1 {
+		if v, err := strconv.ParseUint(values[len(values)-1], 10, 32); err == nil {
+			ttl = uint32(v)
+			values = values[:len(values)-1]
+		}
+	}
+	hdr := dns.RR_Header{Name: netutils.NormalizeFqdn(name), Class: dns.ClassINET, Ttl: ttl}
+	switch qtype {
+	case "A", "AAAA":
+		ip := net.ParseIP(values[0])
+		if ip == nil || (qtype == "A") != (ip.To4() != nil) {
+			return
+		}
+		h.addRecord(name, hostsAddrRR(name, ip, ttl))
+	case "CNAME":
+		hdr.Rrtype = dns.TypeCNAME
+		h.addRecord(name, &dns.CNAME{Hdr: hdr, Target: netutils.NormalizeFqdn(values[0])})
+	case "TXT":
+		hdr.Rrtype = dns.TypeTXT
+		txt := strings.Trim(strings.Join(values, " "), `"`)
+		h.addRecord(name, &dns.TXT{Hdr: hdr, Txt: []string{txt}})
+	}
+}
+
+func hostsAddrRR(name string, ip net.IP, ttl uint32) dns.RR {
+	hdr := dns.RR_Header{Name: netutils.NormalizeFqdn(name), Class: dns.ClassINET, Ttl: ttl}
+	if ip4 := ip.To4(); ip4 != nil {
+		hdr.Rrtype = dns.TypeA
+		return &dns.A{Hdr: hdr, A: ip4}
+	}
+	hdr.Rrtype = dns.TypeAAAA
+	return &dns.AAAA{Hdr: hdr, AAAA: ip}
+}
+
+func (h *HostsData) addRecord(name string, rr dns.RR) {
+	name = netutils.NormalizeDomain(name)
+	if strings.HasPrefix(name, "*.") {
+		h.wildcard[name[2:]] = append(h.wildcard[name[2:]], rr)
+	} else {
+		h.records[name] = append(h.records[name], rr)
+	}
+	h.count++
+}
+
+// find 查找域名的所有记录, 精确匹配优先, 其次为最近的通配记录
+func (h *HostsData) find(name string) ([]dns.RR, bool) {
+	if rrs, ok := h.records[name]; ok {
+		return rrs, false
+	}
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		if rrs, ok := h.wildcard[name[off:]]; ok {
+			return rrs, true
+		}
+	}
+	return nil, false
+}
+
+// Lookup 查询本地应答记录, found 表示域名存在于表中(可能没有该类型的记录)
+func (h *HostsData) Lookup(name string, qtype uint16) (answer []dns.RR, found bool) {
+	h.RLock()
+	defer h.RUnlock()
+	name = netutils.NormalizeDomain(name)
+	owner := dns.Fqdn(name)
+	for i := 0; i < hostsMaxChase; i++ {
+		rrs, wildcard := h.find(name)
+		if rrs == nil {
+			return answer, found
+		}
+		found = true
+		var cname *dns.CNAME
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == qtype {
+				answer = append(answer, hostsCopyRR(rr, owner, wildcard))
+			} else if c, ok := rr.(*dns.CNAME); ok && cname == nil {
+				cname = c
+			}
+		}
+		if len(answer) > 0 || cname == nil || qtype == dns.TypeCNAME {
+			return answer, found
+		}
+		answer = append(answer, hostsCopyRR(cname, owner, wildcard))
+		name = strings.TrimSuffix(cname.Target, ".")
+		owner = cname.Target
+	}
+	return answer, found
+}
+
+// hostsCopyRR 复制记录, 通配记录使用查询名作为 owner
+func hostsCopyRR(rr dns.RR, owner string, wildcard bool) dns.RR {
+	c := dns.Copy(rr)
+	if wildcard {
+		c.Header().Name = owner
+	}
+	return c
+}
+
+func (h *HostsData) Match(name string) bool {
+	h.RLock()
+	defer h.RUnlock()
+	rrs, _ := h.find(netutils.NormalizeDomain(name))
+	return rrs != nil
+}
+
+func (h *HostsData) MatchNet(inet iplib.Net) bool {
+	return false
+}
+
+func (h *HostsData) LessString() string {
+	sb := strings.Builder{}
+	sb.WriteString("HostsData(Top10):{")
+	items := make([]string, 0)
+	h.ForEach(func(item interface{}) error {
+		items = append(items, item.(string))
+		return nil
+	}, 10)
+	sb.WriteString(strings.Join(items, ","))
+	sb.WriteString("...}")
+	return sb.String()
+}
+
+func (h *HostsData) Len() int {
+	h.RLock()
+	defer h.RUnlock()
+	return h.count
+}
+
+func (h *HostsData) ForEach(f func(interface{}) error, max int) {
+	h.RLock()
+	defer h.RUnlock()
+	c := 0
+	for _, table := range []map[string][]dns.RR{h.records, h.wildcard} {
+		for _, rrs := range table {
+			for _, rr := range rrs {
+				if max > 0 && c >= max {
+					return
+				}
+				_ = f(rr.String())
+				c++
+			}
+		}
+	}
+}
@@ -8,82 +8,129 @@ import (
 	"sync"
 
 	"github.com/c-robinson/iplib"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
 )
 
-type keywordData struct {
+// KeywordData 关键词表, 加载时编译为 Aho-Corasick 自动机后整体替换
+type KeywordData struct {
 	sync.RWMutex
-	tag  string
-	data []string
+	tag     string
+	matcher *netutils.KeywordMatcher
+	except  *netutils.KeywordMatcher // 例外关键词, 覆盖 matcher 的命中结果
 }
 
-func newKeywordData(tag string) *keywordData {
-	return &keywordData{tag: tag, data: make([]string, 0)}
+func newKeywordData(tag string) *KeywordData {
+	return &KeywordData{tag: tag, matcher: netutils.NewKeywordMatcher(nil), except: netutils.NewKeywordMatcher(nil)}
 }
 
-func (k *keywordData) Reset() {
-	k.Lock()
-	defer k.Unlock()
-	k.data = make([]string, 0)
+func (k *KeywordData) getMatcher() *netutils.KeywordMatcher {
+	k.RLock()
+	defer k.RUnlock()
+	return k.matcher
 }
 
-func (k *keywordData) ParseFile(r io.Reader) error {
+func (k *KeywordData) getExcept() *netutils.KeywordMatcher {
+	k.RLock()
+	defer k.RUnlock()
+	return k.except
+}
+
+func (k *KeywordData) setMatcher(m, except *netutils.KeywordMatcher) {
 	k.Lock()
 	defer k.Unlock()
-	k.data = make([]string, 0)
+	k.matcher = m
+	k.except = except
+}
+
+func (k *KeywordData) Reset() {
+	k.setMatcher(netutils.NewKeywordMatcher(nil), netutils.NewKeywordMatcher(nil))
+}
+
+func (k *KeywordData) ParseFile(r io.Reader) error {
+	var words, excepts []string
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
-		line := scanner.Text()
-		k.parseline(line)
+		words, excepts = k.parseline(words, excepts, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
 	}
+	k.setMatcher(netutils.NewKeywordMatcher(words), netutils.NewKeywordMatcher(excepts))
 	return nil
 }
 
-func (k *keywordData) ParseLines(lines []string, reset bool) {
-	k.Lock()
-	defer k.Unlock()
-	if reset {
-		k.data = make([]string, 0)
+func (k *KeywordData) ParseLines(lines []string, reset bool) {
+	var words, excepts []string
+	if !reset {
+		words = append(words, k.getMatcher().Keywords()...)
+		excepts = append(excepts, k.getExcept().Keywords()...)
 	}
 	for _, line := range lines {
-		k.parseline(line)
+		words, excepts = k.parseline(words, excepts, line)
 	}
+	k.setMatcher(netutils.NewKeywordMatcher(words), netutils.NewKeywordMatcher(excepts))
 }
 
-func (k *keywordData) parseline(line string) {
+// parseline 解析一行关键词, 例外关键词写作 `@@word`, `tag @@word` 或 `tag except word`
+func (k *KeywordData) parseline(words, excepts []string, line string) ([]string, []string) {
 	if i := strings.IndexByte(line, '#'); i >= 0 {
 		line = line[:i]
 	}
 	attrs := strings.Fields(line)
 	if len(attrs) == 1 {
-		k.data = append(k.data, line)
-		return
+		return addKeyword(words, excepts, attrs[0])
 	}
-	if len(attrs) < 2 {
-		return
+	if len(attrs) < 2 || k.tag != strings.ToUpper(attrs[0]) {
+		return words, excepts
 	}
-	if k.tag == strings.ToUpper(attrs[0]) {
-		k.data = append(k.data, attrs[1])
+	if attrs[1] == netutils.MatchExceptType {
+		if len(attrs) > 2 {
+			excepts = append(excepts, attrs[2])
+		}
+		return words, excepts
 	}
+	return addKeyword(words, excepts, attrs[1])
 }
 
-func (k *keywordData) Match(name string) bool {
-	k.RLock()
-	defer k.RUnlock()
-	for _, k := range k.data {
-		if strings.Contains(name, k) {
-			return true
-		}
+// addKeyword 添加关键词, 以 ExceptPrefix 开头的关键词加入例外列表
+func addKeyword(words, excepts []string, word string) ([]string, []string) {
+	if strings.HasPrefix(word, ExceptPrefix) {
+		return words, append(excepts, word[len(ExceptPrefix):])
 	}
-	return false
+	return append(words, word), excepts
 }
 
-func (k *keywordData) LessString() string {
-	k.RLock()
-	defer k.RUnlock()
+// Match 包含关键词且不包含例外关键词
+func (k *KeywordData) Match(name string) bool {
+	name = netutils.NormalizeDomain(name)
+	return k.getMatcher().Contains(name) && !k.getExcept().Contains(name)
+}
+
+// MatchKeyword 返回域名命中的关键词, 不检查例外关键词
+func (k *KeywordData) MatchKeyword(name string) (string, bool) {
+	return k.getMatcher().Match(netutils.NormalizeDomain(name))
+}
+
+// Keywords 返回去重后的关键词
+func (k *KeywordData) Keywords() []string {
+	return k.getMatcher().Keywords()
+}
+
+// ExceptKeywords 返回去重后的例外关键词
+func (k *KeywordData) ExceptKeywords() []string {
+	return k.getExcept().Keywords()
+}
+
+// MatchException 返回域名命中的例外关键词
+func (k *KeywordData) MatchException(name string) (string, bool) {
+	return k.getExcept().Match(netutils.NormalizeDomain(name))
+}
+
+func (k *KeywordData) LessString() string {
 	sb := strings.Builder{}
 	sb.WriteString("keywordData(Top10):{")
 	c := 0
-	for _, v := range k.data {
+	for _, v := range k.getMatcher().Keywords() {
 		if c >= 10 {
 			break
 		} else {
@@ -96,38 +143,36 @@ func (k *keywordData) LessString() string {
 	return sb.String()
 }
 
-func (k *keywordData) ParseInline(ws []string) {
-	if k.data == nil {
-		k.data = make([]string, 0)
-	}
+func (k *KeywordData) ParseInline(ws []string) {
 	if len(ws) < 2 {
 		fmt.Println("inline len must > 2, format is  tag word...")
 		return
 	}
 	k.Lock()
-	defer k.Unlock()
 	k.tag = ws[0]
-	k.data = ws[1:]
+	k.Unlock()
+	var words, excepts []string
+	for _, w := range ws[1:] {
+		words, excepts = addKeyword(words, excepts, w)
+	}
+	k.setMatcher(netutils.NewKeywordMatcher(words), netutils.NewKeywordMatcher(excepts))
 }
 
-func (k *keywordData) Len() int {
-	k.RLock()
-	defer k.RUnlock()
-	return len(k.data)
+func (k *KeywordData) Len() int {
+	return k.getMatcher().Len()
 }
 
-func (k *keywordData) MatchNet(n iplib.Net) bool {
+func (k *KeywordData) MatchNet(n iplib.Net) bool {
 	return false
 }
 
-func (k *keywordData) ForEach(f func(interface{}) error, max int) {
-	k.RLock()
-	defer k.RUnlock()
+func (k *KeywordData) ForEach(f func(interface{}) error, max int) {
 	c := 0
-	for _, datum := range k.data {
+	for _, datum := range k.getMatcher().Keywords() {
 		if max > 0 && c >= max {
 			break
 		}
 		_ = f(datum)
+		c++
 	}
 }
@@ -4,72 +4,137 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/c-robinson/iplib"
-	"github.com/metaslink/metasdns/plugin/pkg/netutils"
+	"github.com/ca17/datahub/plugin/pkg/netutils"
 )
 
+// NetlistData 网络地址表, 条目为 IP, CIDR 或 AS 编号(如 AS13335), AS 编号通过 asn_table 匹配
 type NetlistData struct {
+	sync.RWMutex
 	tag  string
 	data *netutils.NetList
+	asns map[uint32]bool
 }
 
 func newNetlistData(tag string) *NetlistData {
-	return &NetlistData{tag: tag, data: &netutils.NetList{}}
+	return &NetlistData{tag: tag, data: netutils.NewNetList(nil), asns: make(map[uint32]bool)}
 }
 
 func (n *NetlistData) Reset() {
 	n.data.Clear()
+	n.Lock()
+	n.asns = make(map[uint32]bool)
+	n.Unlock()
 }
 
+// ParseFile 离线构建新列表后整体替换, 重叠与相邻网段在加载时合并
 func (n *NetlistData) ParseFile(r io.Reader) error {
-	n.data.Clear()
+	list, asns := netutils.NewNetList(nil), make(map[uint32]bool)
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
-		line := scanner.Text()
-		n.parseline(line)
+		n.parseline(list, asns, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
 	}
+	n.swap(list, asns)
 	return nil
 }
 
 func (n *NetlistData) ParseLines(lines []string, reset bool) {
-	if reset {
-		n.data.Clear()
+	if !reset {
+		n.Lock()
+		for _, line := range lines {
+			n.parseline(n.data, n.asns, line)
+		}
+		n.Unlock()
+		return
 	}
+	list, asns := netutils.NewNetList(nil), make(map[uint32]bool)
 	for _, line := range lines {
-		n.parseline(line)
+		n.parseline(list, asns, line)
 	}
+	n.swap(list, asns)
+}
+
+func (n *NetlistData) swap(list *netutils.NetList, asns map[uint32]bool) {
+	n.data.Swap(list)
+	n.Lock()
+	n.asns = asns
+	n.Unlock()
 }
 
-func (n *NetlistData) parseline(line string) {
+func (n *NetlistData) parseline(list *netutils.NetList, asns map[uint32]bool, line string) {
 	if i := strings.IndexByte(line, '#'); i >= 0 {
 		line = line[:i]
 	}
 	attrs := strings.Fields(line)
 	if len(attrs) == 1 {
-		n.data.AddByString(line)
+		addNetEntry(list, asns, attrs[0])
 		return
 	}
 	if len(attrs) < 2 {
 		return
 	}
 	if n.tag == strings.ToUpper(attrs[0]) {
-		n.data.AddByString(attrs[1])
+		addNetEntry(list, asns, attrs[1])
 	}
 }
 
+// addNetEntry 添加网段或 AS 编号, AS 编号必须带 AS 前缀
+func addNetEntry(list *netutils.NetList, asns map[uint32]bool, s string) {
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		if asn, ok := ParseASN(s); ok {
+			asns[asn] = true
+		}
+		return
+	}
+	list.AddByString(s)
+}
+
 func (n *NetlistData) ParseInline(ws []string) {
 	if len(ws) < 2 {
 		fmt.Println("inline len must > 2, format is  tag word...")
 		return
 	}
 	n.tag = ws[0]
+	n.Lock()
+	defer n.Unlock()
 	for _, s := range ws[1:] {
-		n.data.AddByString(s)
+		addNetEntry(n.data, n.asns, s)
 	}
 }
 
+// HasASN 判断表中是否包含 AS 编号
+func (n *NetlistData) HasASN(asn uint32) bool {
+	n.RLock()
+	defer n.RUnlock()
+	return n.asns[asn]
+}
+
+// ASNLen AS 编号数量
+func (n *NetlistData) ASNLen() int {
+	n.RLock()
+	defer n.RUnlock()
+	return len(n.asns)
+}
+
+// ASNs 返回排序后的 AS 编号
+func (n *NetlistData) ASNs() []uint32 {
+	n.RLock()
+	asns := make([]uint32, 0, len(n.asns))
+	for asn := range n.asns {
+		asns = append(asns, asn)
+	}
+	n.RUnlock()
+	sort.Slice(asns, func(i, j int) bool { return asns[i] < asns[j] })
+	return asns
+}
+
 func (n *NetlistData) Match(name string) bool {
 	inet, err := netutils.ParseIpNet(name)
 	if err != nil {
@@ -82,6 +147,11 @@ func (n *NetlistData) MatchNet(inet iplib.Net) bool {
 	return n.data.MatchNet(inet)
 }
 
+// FindNet 返回包含 inet 的网段
+func (n *NetlistData) FindNet(inet iplib.Net) iplib.Net {
+	return n.data.FindNet(inet)
+}
+
 func (n *NetlistData) LessString() string {
 	sb := strings.Builder{}
 	sb.WriteString("NetlistData(Top10):{")
@@ -94,12 +164,25 @@ func (n *NetlistData) LessString() string {
 	return sb.String()
 }
 
+// Len 网段与 AS 编号数量
 func (n *NetlistData) Len() int {
-	return n.data.Len()
+	n.RLock()
+	defer n.RUnlock()
+	return n.data.Len() + len(n.asns)
 }
 
+// ForEach 先遍历网段, 再以 AS13335 的形式遍历 AS 编号
 func (n *NetlistData) ForEach(f func(interface{}) error, max int) {
+	c := 0
 	n.data.ForEach(func(item iplib.Net) {
 		_ = f(item)
+		c++
 	}, max)
+	for _, asn := range n.ASNs() {
+		if max > 0 && c >= max {
+			return
+		}
+		_ = f(fmt.Sprintf("AS%d", asn))
+		c++
+	}
 }
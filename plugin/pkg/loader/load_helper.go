@@ -133,6 +133,53 @@ func LoadGeoSiteFromDATByTags(file string, tags []string) ([]*v2data.GeoSite, er
 	return items, nil
 }
 
+// ParseGeoSiteSelector 解析 geosite 选择器 `tag[@attr][@!attr]...`, 返回分类名, 必须包含与必须排除的属性
+func ParseGeoSiteSelector(selector string) (code string, attrs []string, excludes []string) {
+	parts := strings.Split(selector, "@")
+	code = parts[0]
+	for _, p := range parts[1:] {
+		p = strings.ToLower(strings.TrimSpace(p))
+		switch {
+		case p == "" || p == "!":
+		case strings.HasPrefix(p, "!"):
+			excludes = append(excludes, p[1:])
+		default:
+			attrs = append(attrs, p)
+		}
+	}
+	return code, attrs, excludes
+}
+
+// mustNotHaveAttr checks if attr has none of unwanted attrs.
+func mustNotHaveAttr(attr, unwanted []string) bool {
+	for _, u := range unwanted {
+		for _, got := range attr {
+			if got == u {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// FilterGeoSiteDomains 按属性过滤 geosite 域名, attrs 全部包含且 excludes 均不包含时保留
+func FilterGeoSiteDomains(site *v2data.GeoSite, attrs, excludes []string) []*v2data.Domain {
+	if len(attrs) == 0 && len(excludes) == 0 {
+		return site.GetDomain()
+	}
+	var result []*v2data.Domain
+	for _, d := range site.GetDomain() {
+		var got []string
+		for _, a := range d.GetAttribute() {
+			got = append(got, strings.ToLower(a.GetKey()))
+		}
+		if mustHaveAttr(got, attrs) && mustNotHaveAttr(got, excludes) {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
 func LoadGeoSiteList(file string) (*v2data.GeoSiteList, error) {
 	data, raw, err := matcherCache.LoadFromCacheOrRawDisk(file)
 	if err != nil {
@@ -45,3 +45,13 @@ func TestLoadGeositeCn(t *testing.T) {
 		count++
 	}
 }
+
+func TestParseGeoSiteSelector(t *testing.T) {
+	code, attrs, excludes := ParseGeoSiteSelector("geolocation-cn@CN@!ads@")
+	if code != "geolocation-cn" || len(attrs) != 1 || attrs[0] != "cn" || len(excludes) != 1 || excludes[0] != "ads" {
+		t.Errorf("ParseGeoSiteSelector = %s %v %v", code, attrs, excludes)
+	}
+	if code, attrs, excludes := ParseGeoSiteSelector("cn"); code != "cn" || attrs != nil || excludes != nil {
+		t.Fail()
+	}
+}
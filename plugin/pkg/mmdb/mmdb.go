@@ -0,0 +1,201 @@
+package mmdb
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+const (
+	TagContinentPrefix = "CONTINENT:"
+	TagCityPrefix      = "CITY:"
+	TagAsnPrefix       = "ASN:"
+)
+
+// Record GeoLite2/GeoIP2/DB-IP 数据库中使用的字段, 不存在的字段为空
+type Record struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+	Continent struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"continent"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	AutonomousSystemNumber       uint32 `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+// CountryCode 国家 ISO 代码, 国家缺失时使用注册国家
+func (r *Record) CountryCode() string {
+	if r.Country.IsoCode != "" {
+		return strings.ToUpper(r.Country.IsoCode)
+	}
+	return strings.ToUpper(r.RegisteredCountry.IsoCode)
+}
+
+// Tags 返回记录对应的标签: 国家代码, CONTINENT:大洲代码, ASN:编号
+func (r *Record) Tags() []string {
+	var tags []string
+	if cc := r.CountryCode(); cc != "" {
+		tags = append(tags, cc)
+	}
+	if r.Continent.Code != "" {
+		tags = append(tags, TagContinentPrefix+strings.ToUpper(r.Continent.Code))
+	}
+	if r.AutonomousSystemNumber != 0 {
+		tags = append(tags, TagAsnPrefix+strconv.FormatUint(uint64(r.AutonomousSystemNumber), 10))
+	}
+	return tags
+}
+
+// Match 判断记录是否匹配标签, 标签不区分大小写, 格式为:
+//
+//	CN               国家 ISO 代码
+//	continent:EU     大洲代码
+//	city:beijing     城市英文名称
+//	asn:13335        自治系统编号, 也可写作 AS13335
+func (r *Record) Match(tag string) bool {
+	tag = strings.ToUpper(tag)
+	switch {
+	case strings.HasPrefix(tag, TagContinentPrefix):
+		return r.Continent.Code != "" && strings.EqualFold(r.Continent.Code, tag[len(TagContinentPrefix):])
+	case strings.HasPrefix(tag, TagCityPrefix):
+		name := r.City.Names["en"]
+		return name != "" && strings.EqualFold(name, tag[len(TagCityPrefix):])
+	case strings.HasPrefix(tag, TagAsnPrefix):
+		return r.matchASN(tag[len(TagAsnPrefix):])
+	case len(tag) > 2 && strings.HasPrefix(tag, "AS") && tag[2] >= '0' && tag[2] <= '9':
+		return r.matchASN(tag[2:])
+	}
+	cc := r.CountryCode()
+	return cc != "" && cc == tag
+}
+
+// IsTag 判断标签是否可能被 mmdb 记录匹配, 即国家代码, 大洲, 城市或自治系统编号格式,
+// 其他标签(如自定义网络地址表标签)无需查询 mmdb
+func IsTag(tag string) bool {
+	tag = strings.ToUpper(tag)
+	switch {
+	case strings.HasPrefix(tag, TagContinentPrefix), strings.HasPrefix(tag, TagCityPrefix),
+		strings.HasPrefix(tag, TagAsnPrefix):
+		return true
+	case len(tag) > 2 && strings.HasPrefix(tag, "AS") && tag[2] >= '0' && tag[2] <= '9':
+		return true
+	}
+	return len(tag) == 2 && tag[0] >= 'A' && tag[0] <= 'Z' && tag[1] >= 'A' && tag[1] <= 'Z'
+}
+
+func (r *Record) matchASN(s string) bool {
+	n, err := strconv.ParseUint(s, 10, 32)
+	return err == nil && n != 0 && uint32(n) == r.AutonomousSystemNumber
+}
+
+// Reader mmdb 文件读取器, 文件修改时间或大小变化后可通过 Reload 重新打开
+type Reader struct {
+	sync.RWMutex
+	path   string
+	mtime  time.Time
+	size   int64
+	reader *maxminddb.Reader
+}
+
+// Open 打开 mmdb 文件
+func Open(path string) (*Reader, error) {
+	r := &Reader{path: path}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reader) Path() string {
+	return r.path
+}
+
+// DatabaseType 数据库类型, 如 GeoLite2-Country
+func (r *Reader) DatabaseType() string {
+	r.RLock()
+	defer r.RUnlock()
+	if r.reader == nil {
+		return ""
+	}
+	return r.reader.Metadata.DatabaseType
+}
+
+// Reload 文件变化时重新打开, 返回是否已重新加载
+func (r *Reader) Reload() (bool, error) {
+	stat, err := os.Stat(r.path)
+	if err != nil {
+		return false, err
+	}
+	r.RLock()
+	unchanged := r.reader != nil && stat.ModTime().Equal(r.mtime) && stat.Size() == r.size
+	r.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	reader, err := maxminddb.Open(r.path)
+	if err != nil {
+		return false, fmt.Errorf("open mmdb %s error %s", r.path, err.Error())
+	}
+	r.Lock()
+	old := r.reader
+	r.reader, r.mtime, r.size = reader, stat.ModTime(), stat.Size()
+	r.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+	return true, nil
+}
+
+// Lookup 查询地址记录, 未找到时返回 nil
+func (r *Reader) Lookup(ip net.IP) *Record {
+	record, _ := r.LookupNetwork(ip)
+	return record
+}
+
+// LookupNetwork 查询地址记录及其所在网段, 未找到时返回 nil
+func (r *Reader) LookupNetwork(ip net.IP) (*Record, *net.IPNet) {
+	if ip == nil {
+		return nil, nil
+	}
+	r.RLock()
+	defer r.RUnlock()
+	if r.reader == nil {
+		return nil, nil
+	}
+	var record Record
+	network, ok, err := r.reader.LookupNetwork(ip, &record)
+	if err != nil || !ok {
+		return nil, nil
+	}
+	return &record, network
+}
+
+// Match 判断地址是否匹配标签
+func (r *Reader) Match(tag string, ip net.IP) bool {
+	record := r.Lookup(ip)
+	return record != nil && record.Match(tag)
+}
+
+func (r *Reader) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	if r.reader == nil {
+		return nil
+	}
+	err := r.reader.Close()
+	r.reader = nil
+	return err
+}
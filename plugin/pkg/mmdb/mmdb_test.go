@@ -0,0 +1,92 @@
+package mmdb
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testDB = "testdata/GeoLite2-City.mmdb"
+
+func TestReader_Match(t *testing.T) {
+	r, err := Open(testDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	ip := net.ParseIP("81.2.69.142")
+	cases := []struct {
+		tag   string
+		match bool
+	}{
+		{"gb", true},
+		{"CN", false},
+		{"continent:eu", true},
+		{"continent:as", false},
+		{"city:cambridge", true},
+		{"city:london", false},
+		{"asn:13335", false},
+		{"AS13335", false},
+	}
+	for _, c := range cases {
+		if r.Match(c.tag, ip) != c.match {
+			t.Errorf("Match(%s) = %v, want %v", c.tag, !c.match, c.match)
+		}
+	}
+	if r.Match("GB", net.ParseIP("8.8.8.8")) || r.Match("GB", nil) {
+		t.Error("unknown address should not match")
+	}
+	if record := r.Lookup(ip); record == nil || len(record.Tags()) != 2 || record.Tags()[1] != "CONTINENT:EU" {
+		t.Errorf("Tags = %v", record.Tags())
+	}
+}
+
+func TestIsTag(t *testing.T) {
+	for tag, want := range map[string]bool{
+		"gb":             true,
+		"continent:eu":   true,
+		"city:cambridge": true,
+		"asn:13335":      true,
+		"AS13335":        true,
+		"OFFICE":         false,
+		"ASN":            false,
+		"g1":             false,
+		"":               false,
+	} {
+		if got := IsTag(tag); got != want {
+			t.Errorf("IsTag(%s) = %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestReader_Reload(t *testing.T) {
+	bs, err := os.ReadFile(testDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(t.TempDir(), "city.mmdb")
+	if err := os.WriteFile(fname, bs, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if reloaded, err := r.Reload(); reloaded || err != nil {
+		t.Errorf("unchanged file reloaded %v %v", reloaded, err)
+	}
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(fname, future, future)
+	if reloaded, err := r.Reload(); !reloaded || err != nil {
+		t.Errorf("changed file not reloaded %v %v", reloaded, err)
+	}
+	if !r.Match("GB", net.ParseIP("81.2.69.142")) {
+		t.Error("lookup after reload failed")
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
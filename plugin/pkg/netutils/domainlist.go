@@ -1,51 +1,59 @@
 package netutils
 
 import (
-	"regexp"
 	"sort"
 	"sync"
-	"time"
-
-	"github.com/allegro/bigcache"
-	"github.com/miekg/dns"
 )
 
 const (
-	MatchFullType   = "full"
-	MatchDomainType = "domain"
-	MatchRegexType  = "regex"
+	MatchFullType    = "full"
+	MatchDomainType  = "domain"
+	MatchRegexType   = "regex"
+	MatchKeywordType = "keyword"
+	MatchCidrType    = "cidr"
+	MatchAsnType     = "asn"
+	MatchExceptType  = "except" // 例外规则, 按后缀匹配覆盖同一标签的命中结果
 )
 
+// DomainList 域名列表, 完整匹配与后缀匹配规则存储在 DomainTrie 中, 关键词规则编译为 KeywordMatcher.
+// 大列表应使用 NewDomainList 离线构建后通过 Swap 整体替换
 type DomainList struct {
 	sync.RWMutex
-	fullTable  *bigcache.BigCache
-	regexTable []*regexp.Regexp
+	trie         *DomainTrie
+	keywordTable []string
+	keywords     *KeywordMatcher // 由 keywordTable 延迟构建
+	regexTable   []*RegexRule
+	regexSet     *RegexSet // 由 regexTable 延迟构建
 }
 
 func NewDomainList() *DomainList {
-	_c, _ := bigcache.NewBigCache(bigcache.DefaultConfig(time.Hour * 24 * 3650))
 	return &DomainList{
 		RWMutex:    sync.RWMutex{},
-		fullTable:  _c,
-		regexTable: make([]*regexp.Regexp, 0),
+		trie:       NewDomainTrie(),
+		regexTable: make([]*RegexRule, 0),
 	}
 }
 
+// Add 添加规则. 完整匹配与后缀匹配规则直接修改 DomainTrie, 而匹配时不持有锁,
+// 因此只能用于尚未发布的列表; 已用于匹配的列表应先 Clone, 添加后再 Swap
 func (l *DomainList) Add(matchType string, name string) bool {
+	l.Lock()
+	defer l.Unlock()
 	switch matchType {
 	case MatchFullType, MatchDomainType:
-		err := l.fullTable.Set(name, []byte("1"))
-		if err != nil {
+		return l.trie.Add(matchType, name)
+	case MatchKeywordType:
+		if name == "" {
 			return false
 		}
+		l.keywordTable = append(l.keywordTable, name)
+		l.keywords = nil
 		return true
 	case MatchRegexType:
-		if l.regexTable == nil {
-			l.regexTable = make([]*regexp.Regexp, 0)
-		}
-		re, err := regexp.Compile(name)
+		r, err := NewRegexRule(name)
 		if err == nil {
-			l.regexTable = append(l.regexTable, re)
+			l.regexTable = append(l.regexTable, r)
+			l.regexSet = nil
 			return true
 		}
 		return false
@@ -54,8 +62,84 @@ func (l *DomainList) Add(matchType string, name string) bool {
 	}
 }
 
+// Clear 清空列表
+func (l *DomainList) Clear() {
+	l.Lock()
+	defer l.Unlock()
+	l.trie = NewDomainTrie()
+	l.keywordTable, l.keywords = nil, nil
+	l.regexTable = make([]*RegexRule, 0)
+	l.regexSet = nil
+}
+
+// Clone 复制列表, 正则规则与原列表共享以保留命中次数
+func (l *DomainList) Clone() *DomainList {
+	l.RLock()
+	defer l.RUnlock()
+	return &DomainList{
+		trie:         l.trie.Clone(),
+		keywordTable: append([]string(nil), l.keywordTable...),
+		keywords:     l.keywords,
+		regexTable:   append(make([]*RegexRule, 0, len(l.regexTable)), l.regexTable...),
+		regexSet:     l.regexSet,
+	}
+}
+
+// Swap 使用 other 的数据替换当前列表, other 构建完成后不应再修改
+func (l *DomainList) Swap(other *DomainList) {
+	regexSet := other.getRegexSet()
+	keywords := other.getKeywords()
+	other.RLock()
+	trie, keywordTable, regexTable := other.trie, other.keywordTable, other.regexTable
+	other.RUnlock()
+	l.Lock()
+	defer l.Unlock()
+	l.trie = trie
+	l.keywordTable, l.keywords = keywordTable, keywords
+	l.regexTable = regexTable
+	l.regexSet = regexSet
+}
+
+func (l *DomainList) getTrie() *DomainTrie {
+	l.RLock()
+	defer l.RUnlock()
+	return l.trie
+}
+
+// getRegexSet 返回正则规则集合, 规则变更后首次匹配时重建
+func (l *DomainList) getRegexSet() *RegexSet {
+	l.RLock()
+	set := l.regexSet
+	l.RUnlock()
+	if set != nil {
+		return set
+	}
+	l.Lock()
+	defer l.Unlock()
+	if l.regexSet == nil {
+		l.regexSet = NewRegexSet(l.regexTable)
+	}
+	return l.regexSet
+}
+
+// getKeywords 返回关键词匹配器, 规则变更后首次匹配时重建
+func (l *DomainList) getKeywords() *KeywordMatcher {
+	l.RLock()
+	m := l.keywords
+	l.RUnlock()
+	if m != nil {
+		return m
+	}
+	l.Lock()
+	defer l.Unlock()
+	if l.keywords == nil {
+		l.keywords = NewKeywordMatcher(l.keywordTable)
+	}
+	return l.keywords
+}
+
 func (l *DomainList) FullLen() int {
-	return l.fullTable.Len()
+	return l.getTrie().Len()
 }
 
 func (l *DomainList) RegexLen() int {
@@ -64,32 +148,56 @@ func (l *DomainList) RegexLen() int {
 	return len(l.regexTable)
 }
 
+func (l *DomainList) KeywordLen() int {
+	return l.getKeywords().Len()
+}
+
 func (l *DomainList) InitDomainData(matchType string, items []string) {
 	switch matchType {
-	case MatchFullType:
+	case MatchFullType, MatchDomainType:
+		trie := NewDomainTrie()
+		l.getTrie().ForEach(func(mtype string, name string) {
+			trie.Add(mtype, name)
+		}, 0)
 		for _, item := range items {
-			_ = l.fullTable.Set(item, []byte("1"))
+			trie.Add(matchType, item)
 		}
+		l.Lock()
+		l.trie = trie
+		l.Unlock()
+	case MatchKeywordType:
+		keywords := NewKeywordMatcher(items)
+		l.Lock()
+		l.keywordTable = keywords.Keywords()
+		l.keywords = keywords
+		l.Unlock()
 	case MatchRegexType:
 		sort.Strings(items)
-		var regexTable []*regexp.Regexp
+		var regexTable []*RegexRule
 		for _, item := range items {
-			re, err := regexp.Compile(item)
+			r, err := NewRegexRule(item)
 			if err == nil {
-				regexTable = append(regexTable, re)
+				regexTable = append(regexTable, r)
 			}
 		}
+		regexSet := NewRegexSet(regexTable)
+		l.Lock()
 		l.regexTable = regexTable
+		l.regexSet = regexSet
+		l.Unlock()
 	default:
 		panic("error matchtype")
 	}
 }
 
+// MixMatch 混合匹配, 完整匹配规则只匹配域名本身, 后缀匹配规则匹配域名及子域名, 关键词规则匹配包含关键词的域名.
+// 匹配函数均先按 NormalizeDomain 规范化域名
 func (l *DomainList) MixMatch(name string) bool {
-	if l.MatchFull(name) {
+	name = NormalizeDomain(name)
+	if l.getTrie().Match(name) {
 		return true
 	}
-	if l.MatchDomain(name) {
+	if l.MatchKeyword(name) {
 		return true
 	}
 	if l.MatchRegex(name) {
@@ -98,12 +206,29 @@ func (l *DomainList) MixMatch(name string) bool {
 	return false
 }
 
+// Lookup 返回命中的规则及其匹配类型, 用于解释匹配结果, 不计入正则命中次数
+func (l *DomainList) Lookup(name string) (matchType string, rule string, ok bool) {
+	name = NormalizeDomain(name)
+	if matchType, rule, ok = l.getTrie().Lookup(name); ok {
+		return
+	}
+	if word, ok := l.getKeywords().Match(name); ok {
+		return MatchKeywordType, word, true
+	}
+	if r, ok := l.getRegexSet().Find(name); ok {
+		return MatchRegexType, r.String(), true
+	}
+	return "", "", false
+}
+
 func (l *DomainList) Match(matchType, name string) bool {
 	switch matchType {
 	case MatchFullType:
 		return l.MatchFull(name)
 	case MatchDomainType:
 		return l.MatchDomain(name)
+	case MatchKeywordType:
+		return l.MatchKeyword(name)
 	case MatchRegexType:
 		return l.MatchRegex(name)
 	default:
@@ -111,60 +236,59 @@ func (l *DomainList) Match(matchType, name string) bool {
 	}
 }
 
+// MatchKeyword 域名包含任一关键词
+func (l *DomainList) MatchKeyword(name string) bool {
+	return l.getKeywords().Contains(NormalizeDomain(name))
+}
+
+// MatchFull 域名与列表中的规则完全相同
 func (l *DomainList) MatchFull(name string) bool {
-	_, err := l.fullTable.Get(name)
-	if err != nil {
-		return false
-	}
-	return true
+	return l.getTrie().MatchFull(name)
 }
 
 func (l *DomainList) MatchRegex(name string) bool {
-	l.RLock()
-	defer l.RUnlock()
-	for _, r := range l.regexTable {
-		if r.MatchString(name) {
-			return true
-		}
-	}
-	return false
+	_, ok := l.getRegexSet().Match(NormalizeDomain(name))
+	return ok
 }
 
-func (l *DomainList) MatchDomain(name string) bool {
-	idx := make([]int, 1, 6)
-	off := 0
-	end := false
-	for {
-		off, end = dns.NextLabel(name, off)
-		if end {
-			break
-		}
-		idx = append(idx, off)
-	}
+// RegexHits 遍历正则规则及其命中次数
+func (l *DomainList) RegexHits(f func(expr string, hits uint64)) {
+	l.getRegexSet().ForEach(func(r *RegexRule) bool {
+		f(r.String(), r.Hits())
+		return true
+	})
+}
 
-	for i := range idx {
-		p := idx[len(idx)-1-i]
-		qname := name[p:]
-		r, err := l.fullTable.Get(qname)
-		if err == nil && len(r) > 0 {
-			return true
-		}
-	}
-	return false
+// MatchDomain 域名为后缀匹配规则本身或其子域名
+func (l *DomainList) MatchDomain(name string) bool {
+	return l.getTrie().MatchDomain(name)
 }
 
 func (l *DomainList) ForEach(f func(name string), max int) {
+	l.ForEachRule(func(matchType string, name string) {
+		f(name)
+	}, max)
+}
+
+// ForEachRule 遍历规则及其匹配类型, 完整匹配与后缀匹配规则最多占 max 的一半
+func (l *DomainList) ForEachRule(f func(matchType string, name string), max int) {
 	c := 0
-	iter := l.fullTable.Iterator()
-	for iter.SetNext() {
-		current, err := iter.Value()
-		if err == nil {
-			if max > 0 && c >= max/2 {
-				break
-			}
-			f(current.Key())
+	half := 0
+	if max > 0 {
+		half = max / 2
+	}
+	if max <= 0 || half > 0 {
+		l.getTrie().ForEach(func(matchType string, name string) {
+			f(matchType, name)
 			c++
+		}, half)
+	}
+	for _, word := range l.getKeywords().Keywords() {
+		if max > 0 && c >= max {
+			return
 		}
+		f(MatchKeywordType, word)
+		c++
 	}
 	l.RLock()
 	defer l.RUnlock()
@@ -172,7 +296,7 @@ func (l *DomainList) ForEach(f func(name string), max int) {
 		if max > 0 && c >= max {
 			return
 		}
-		f(d.String())
+		f(MatchRegexType, d.String())
 		c++
 	}
 }
@@ -1,7 +1,12 @@
 package netutils
 
 import (
+	"fmt"
 	"testing"
+	"time"
+
+	"github.com/allegro/bigcache"
+	"github.com/miekg/dns"
 )
 
 func TestDomainList_Match(t *testing.T) {
@@ -21,3 +26,164 @@ func TestDomainList_Match(t *testing.T) {
 		t.Log("match reg www.abc.com")
 	}
 }
+
+func TestDomainList_FullAndDomain(t *testing.T) {
+	d := NewDomainList()
+	d.Add(MatchFullType, "full.com")
+	d.Add(MatchDomainType, "suffix.com")
+	d.Add(MatchDomainType, "co.uk.")
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{"full.com", true},
+		{"www.full.com", false},
+		{"suffix.com", true},
+		{"a.b.suffix.com", true},
+		{"nosuffix.com", false},
+		{"bbc.co.uk.", true},
+		{"uk", false},
+		{"com", false},
+	}
+	for _, c := range cases {
+		if got := d.MixMatch(c.name); got != c.want {
+			t.Errorf("MixMatch(%s) = %v, want %v", c.name, got, c.want)
+		}
+	}
+	if !d.MatchFull("suffix.com") || d.MatchDomain("full.com") {
+		t.Fail()
+	}
+	if d.FullLen() != 3 {
+		t.Errorf("FullLen = %d", d.FullLen())
+	}
+}
+
+func TestDomainList_Swap(t *testing.T) {
+	d := NewDomainList()
+	d.Add(MatchDomainType, "old.com")
+	n := NewDomainList()
+	n.Add(MatchDomainType, "new.com")
+	n.Add(MatchRegexType, "^ads\\.")
+	d.Swap(n)
+	if d.MixMatch("old.com") || !d.MixMatch("www.new.com") || !d.MixMatch("ads.example.com") {
+		t.Fail()
+	}
+	d.Clear()
+	if d.MixMatch("new.com") || d.FullLen() != 0 || d.RegexLen() != 0 {
+		t.Fail()
+	}
+}
+
+func TestDomainList_Clone(t *testing.T) {
+	d := NewDomainList()
+	d.Add(MatchDomainType, "a.com")
+	d.Add(MatchKeywordType, "ads")
+	d.Add(MatchRegexType, "^tr\\.")
+	c := d.Clone()
+	c.Add(MatchDomainType, "b.com")
+	c.Add(MatchFullType, "x.a.com")
+	if d.MixMatch("b.com") || d.FullLen() != 1 {
+		t.Error("clone should not modify the original list")
+	}
+	if !c.MixMatch("www.a.com") || !c.MixMatch("b.com") || !c.MixMatch("myads.net") || !c.MixMatch("tr.example.com") || c.FullLen() != 3 {
+		t.Error("clone should keep the original rules")
+	}
+	d.Swap(c)
+	if !d.MixMatch("b.com") || !d.MatchFull("x.a.com") {
+		t.Error("swap clone error")
+	}
+}
+
+func TestDomainTrie_ForEach(t *testing.T) {
+	tr := NewDomainTrie()
+	tr.Add(MatchFullType, "a.com")
+	tr.Add(MatchDomainType, "a.com")
+	tr.Add(MatchDomainType, "b.a.com")
+	var items []string
+	tr.ForEach(func(matchType string, name string) {
+		items = append(items, matchType+":"+name)
+	}, 0)
+	if len(items) != 3 || items[0] != "full:a.com" || items[2] != "domain:b.a.com" {
+		t.Errorf("ForEach = %v", items)
+	}
+	if tr.Len() != 2 {
+		t.Errorf("Len = %d", tr.Len())
+	}
+}
+
+func benchDomains(n int) []string {
+	domains := make([]string, n)
+	for i := range domains {
+		domains[i] = fmt.Sprintf("s%d.example%d.com", i, i%1000)
+	}
+	return domains
+}
+
+func BenchmarkDomainTrieMatch(b *testing.B) {
+	d := NewDomainList()
+	d.InitDomainData(MatchDomainType, benchDomains(100000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		d.MixMatch("www.s99999.example999.com")
+	}
+}
+
+func BenchmarkDomainTrieMiss(b *testing.B) {
+	d := NewDomainList()
+	d.InitDomainData(MatchDomainType, benchDomains(100000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		d.MixMatch("www.google.com")
+	}
+}
+
+// BenchmarkBigcacheMatch 原 bigcache 实现的后缀匹配, 作为对照
+func BenchmarkBigcacheMatch(b *testing.B) {
+	c, _ := bigcache.NewBigCache(bigcache.DefaultConfig(time.Hour * 24 * 3650))
+	for _, d := range benchDomains(100000) {
+		_ = c.Set(d, []byte("1"))
+	}
+	name := "www.s99999.example999.com"
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		idx := make([]int, 1, 6)
+		off := 0
+		end := false
+		for {
+			off, end = dns.NextLabel(name, off)
+			if end {
+				break
+			}
+			idx = append(idx, off)
+		}
+		for i := range idx {
+			if _, err := c.Get(name[idx[len(idx)-1-i]:]); err == nil {
+				break
+			}
+		}
+	}
+}
+
+func TestDomainList_Lookup(t *testing.T) {
+	d := NewDomainList()
+	d.Add(MatchDomainType, "example.com")
+	d.Add(MatchDomainType, "a.example.com")
+	d.Add(MatchFullType, "b.example.com")
+	d.Add(MatchRegexType, `^ads\.`)
+	for name, want := range map[string]string{
+		"example.com":     "domain:example.com",
+		"x.a.example.com": "domain:a.example.com",
+		"b.example.com":   "full:b.example.com",
+		"c.b.example.com": "domain:example.com",
+		"ads.test.net":    `regex:^ads\.`,
+		"test.net":        ":",
+	} {
+		mtype, rule, _ := d.Lookup(name)
+		if got := mtype + ":" + rule; got != want {
+			t.Errorf("Lookup(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package netutils
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	trieFlagFull   uint8 = 1 << iota // 完整匹配规则
+	trieFlagDomain                   // 后缀匹配规则
+)
+
+// DomainTrie 按反向标签组织的域名树, 区分完整匹配与后缀匹配规则.
+// DomainTrie 本身不加锁, 构建完成后只读使用, 更新时构建新树整体替换
+type DomainTrie struct {
+	root trieNode
+	size int
+}
+
+type trieNode struct {
+	label    string
+	flags    uint8
+	children []*trieNode // 按 label 排序
+}
+
+func NewDomainTrie() *DomainTrie {
+	return &DomainTrie{}
+}
+
+func (n *trieNode) child(label string) *trieNode {
+	i := sort.Search(len(n.children), func(i int) bool { return n.children[i].label >= label })
+	if i < len(n.children) && n.children[i].label == label {
+		return n.children[i]
+	}
+	return nil
+}
+
+func (n *trieNode) addChild(label string) *trieNode {
+	i := sort.Search(len(n.children), func(i int) bool { return n.children[i].label >= label })
+	if i < len(n.children) && n.children[i].label == label {
+		return n.children[i]
+	}
+	c := &trieNode{label: label}
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = c
+	return c
+}
+
+// lastLabel 返回 name[:end] 的最后一个标签及其起始位置
+func lastLabel(name string, end int) (string, int) {
+	i := strings.LastIndexByte(name[:end], '.')
+	return name[i+1 : end], i
+}
+
+// Clone 复制整棵树, 用于在已发布的树基础上构建新树
+func (t *DomainTrie) Clone() *DomainTrie {
+	return &DomainTrie{root: *t.root.clone(), size: t.size}
+}
+
+func (n *trieNode) clone() *trieNode {
+	c := &trieNode{label: n.label, flags: n.flags}
+	if len(n.children) > 0 {
+		c.children = make([]*trieNode, len(n.children))
+		for i, child := range n.children {
+			c.children[i] = child.clone()
+		}
+	}
+	return c
+}
+
+// Add 添加规则, matchType 为 MatchFullType 或 MatchDomainType
+func (t *DomainTrie) Add(matchType string, name string) bool {
+	var flag uint8
+	switch matchType {
+	case MatchFullType:
+		flag = trieFlagFull
+	case MatchDomainType:
+		flag = trieFlagDomain
+	default:
+		return false
+	}
+	name = NormalizeDomain(name)
+	if name == "" {
+		return false
+	}
+	n := &t.root
+	for end := len(name); end >= 0; {
+		label, i := lastLabel(name, end)
+		n = n.addChild(label)
+		end = i
+	}
+	if n.flags&flag == 0 {
+		if n.flags == 0 {
+			t.size++
+		}
+		n.flags |= flag
+	}
+	return true
+}
+
+// lookup 查找 name, full 表示存在完整匹配规则, domain 表示 name 或其上级域名存在后缀匹配规则
+func (t *DomainTrie) lookup(name string) (full bool, domain bool) {
+	name = NormalizeDomain(name)
+	if name == "" {
+		return false, false
+	}
+	n := &t.root
+	for end := len(name); end >= 0; {
+		label, i := lastLabel(name, end)
+		if n = n.child(label); n == nil {
+			return false, domain
+		}
+		if n.flags&trieFlagDomain != 0 {
+			domain = true
+		}
+		end = i
+	}
+	return n.flags&trieFlagFull != 0, domain
+}
+
+// Lookup 查找命中的规则, 完整匹配规则优先, 其次为最具体的后缀匹配规则
+func (t *DomainTrie) Lookup(name string) (matchType string, rule string, ok bool) {
+	name = NormalizeDomain(name)
+	if name == "" {
+		return "", "", false
+	}
+	n := &t.root
+	for end := len(name); end >= 0; {
+		label, i := lastLabel(name, end)
+		if n = n.child(label); n == nil {
+			break
+		}
+		if n.flags&trieFlagDomain != 0 {
+			matchType, rule, ok = MatchDomainType, name[i+1:], true
+		}
+		if i < 0 && n.flags&trieFlagFull != 0 {
+			return MatchFullType, name, true
+		}
+		end = i
+	}
+	return matchType, rule, ok
+}
+
+// MatchFull 完整匹配, 域名与完整匹配规则或后缀匹配规则本身相同
+func (t *DomainTrie) MatchFull(name string) bool {
+	name = NormalizeDomain(name)
+	if name == "" {
+		return false
+	}
+	n := &t.root
+	for end := len(name); end >= 0; {
+		label, i := lastLabel(name, end)
+		if n = n.child(label); n == nil {
+			return false
+		}
+		end = i
+	}
+	return n.flags != 0
+}
+
+// MatchDomain 后缀匹配, 域名为后缀匹配规则本身或其子域名
+func (t *DomainTrie) MatchDomain(name string) bool {
+	_, domain := t.lookup(name)
+	return domain
+}
+
+// Match 混合匹配, 完整匹配规则只匹配自身, 后缀匹配规则匹配自身及子域名
+func (t *DomainTrie) Match(name string) bool {
+	full, domain := t.lookup(name)
+	return full || domain
+}
+
+// Len 规则数量, 同一域名的完整匹配与后缀匹配规则计为一条
+func (t *DomainTrie) Len() int {
+	return t.size
+}
+
+// ForEach 遍历规则, max 小于等于 0 时不限制数量
+func (t *DomainTrie) ForEach(f func(matchType string, name string), max int) {
+	c := 0
+	var walk func(n *trieNode, suffix string) bool
+	walk = func(n *trieNode, suffix string) bool {
+		for _, child := range n.children {
+			name := child.label
+			if suffix != "" {
+				name = child.label + "." + suffix
+			}
+			for _, ft := range []struct {
+				flag      uint8
+				matchType string
+			}{{trieFlagFull, MatchFullType}, {trieFlagDomain, MatchDomainType}} {
+				if child.flags&ft.flag == 0 {
+					continue
+				}
+				if max > 0 && c >= max {
+					return false
+				}
+				f(ft.matchType, name)
+				c++
+			}
+			if !walk(child, name) {
+				return false
+			}
+		}
+		return true
+	}
+	walk(&t.root, "")
+}
@@ -0,0 +1,199 @@
+package netutils
+
+import "sort"
+
+// KeywordMatcher 基于 Aho-Corasick 自动机的多关键词匹配器,
+// 构建完成后只读, 更新时构建新的匹配器整体替换
+type KeywordMatcher struct {
+	keywords []string
+	root     [256]int32 // 根节点稠密转移表
+	nodes    []acNode
+}
+
+type acNode struct {
+	labels []byte  // 按字节排序的转移
+	next   []int32 // 与 labels 对应的子节点
+	fail   int32
+	out    int32 // 在此节点结束的关键词下标, -1 表示无
+	dict   int32 // 失败链上最近的有输出节点, -1 表示无
+}
+
+// NewKeywordMatcher 构建匹配器, 关键词与域名一样转为小写, 国际化关键词转换为 punycode,
+// 空关键词与重复关键词被忽略. 匹配时忽略 ASCII 大小写, 国际化域名按 punycode 形式匹配
+func NewKeywordMatcher(keywords []string) *KeywordMatcher {
+	m := &KeywordMatcher{nodes: []acNode{{out: -1, dict: -1}}}
+	for _, kw := range keywords {
+		if kw == "" {
+			continue
+		}
+		kw = normalizeKeyword(kw)
+		s := int32(0)
+		for i := 0; i < len(kw); i++ {
+			s = m.addEdge(s, kw[i])
+		}
+		if m.nodes[s].out < 0 {
+			m.nodes[s].out = int32(len(m.keywords))
+			m.keywords = append(m.keywords, kw)
+		}
+	}
+	m.build()
+	return m
+}
+
+func (m *KeywordMatcher) edge(s int32, c byte) int32 {
+	if s == 0 {
+		return m.root[c]
+	}
+	n := &m.nodes[s]
+	i := sort.Search(len(n.labels), func(i int) bool { return n.labels[i] >= c })
+	if i < len(n.labels) && n.labels[i] == c {
+		return n.next[i]
+	}
+	return -1
+}
+
+func (m *KeywordMatcher) addEdge(s int32, c byte) int32 {
+	if t := m.edge(s, c); t > 0 {
+		return t
+	}
+	t := int32(len(m.nodes))
+	m.nodes = append(m.nodes, acNode{out: -1, dict: -1})
+	if s == 0 {
+		m.root[c] = t
+		return t
+	}
+	n := &m.nodes[s]
+	i := sort.Search(len(n.labels), func(i int) bool { return n.labels[i] >= c })
+	n.labels = append(n.labels, 0)
+	n.next = append(n.next, 0)
+	copy(n.labels[i+1:], n.labels[i:])
+	copy(n.next[i+1:], n.next[i:])
+	n.labels[i] = c
+	n.next[i] = t
+	return t
+}
+
+// build 按广度优先计算失败链接与输出链接
+func (m *KeywordMatcher) build() {
+	queue := make([]int32, 0, len(m.nodes))
+	for c := 0; c < 256; c++ {
+		if t := m.root[c]; t > 0 {
+			queue = append(queue, t)
+		}
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		for i, c := range m.nodes[s].labels {
+			t := m.nodes[s].next[i]
+			f := m.nodes[s].fail
+			for {
+				if ft := m.edge(f, c); ft > 0 {
+					f = ft
+					break
+				}
+				if f == 0 {
+					break
+				}
+				f = m.nodes[f].fail
+			}
+			m.nodes[t].fail = f
+			if m.nodes[f].out >= 0 {
+				m.nodes[t].dict = f
+			} else {
+				m.nodes[t].dict = m.nodes[f].dict
+			}
+			queue = append(queue, t)
+		}
+	}
+}
+
+// Match 返回 name 中最先出现的关键词
+func (m *KeywordMatcher) Match(name string) (string, bool) {
+	if m == nil || len(m.keywords) == 0 {
+		return "", false
+	}
+	s := int32(0)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		for {
+			if t := m.edge(s, c); t > 0 {
+				s = t
+				break
+			}
+			if s == 0 {
+				break
+			}
+			s = m.nodes[s].fail
+		}
+		if s == 0 {
+			continue
+		}
+		if out := m.nodes[s].out; out >= 0 {
+			return m.keywords[out], true
+		}
+		if d := m.nodes[s].dict; d >= 0 {
+			return m.keywords[m.nodes[d].out], true
+		}
+	}
+	return "", false
+}
+
+// Contains 判断 name 是否包含任一关键词
+func (m *KeywordMatcher) Contains(name string) bool {
+	_, ok := m.Match(name)
+	return ok
+}
+
+// Keywords 返回去重后的关键词
+func (m *KeywordMatcher) Keywords() []string {
+	if m == nil {
+		return nil
+	}
+	return m.keywords
+}
+
+func (m *KeywordMatcher) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.keywords)
+}
+
+// MatchEach 按出现顺序回调 name 中命中的每个关键词下标, f 返回 false 时停止
+func (m *KeywordMatcher) MatchEach(name string, f func(i int) bool) {
+	if m == nil || len(m.keywords) == 0 {
+		return
+	}
+	s := int32(0)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		for {
+			if t := m.edge(s, c); t > 0 {
+				s = t
+				break
+			}
+			if s == 0 {
+				break
+			}
+			s = m.nodes[s].fail
+		}
+		if s == 0 {
+			continue
+		}
+		if out := m.nodes[s].out; out >= 0 && !f(int(out)) {
+			return
+		}
+		for d := m.nodes[s].dict; d >= 0; d = m.nodes[d].dict {
+			if !f(int(m.nodes[d].out)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package netutils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestKeywordMatcher_Match(t *testing.T) {
+	m := NewKeywordMatcher([]string{"he", "she", "his", "hers", "google", "", "he"})
+	cases := []struct {
+		name string
+		word string
+		ok   bool
+	}{
+		{"ushers", "she", true},
+		{"ahishers", "his", true},
+		{"www.google.com", "google", true},
+		{"www.goog.com", "", false},
+		{"", "", false},
+		{"xhex", "he", true},
+	}
+	for _, c := range cases {
+		word, ok := m.Match(c.name)
+		if word != c.word || ok != c.ok {
+			t.Errorf("Match(%s) = %s,%v want %s,%v", c.name, word, ok, c.word, c.ok)
+		}
+	}
+	if m.Len() != 5 {
+		t.Errorf("Len = %d", m.Len())
+	}
+	var empty *KeywordMatcher
+	if empty.Contains("abc") {
+		t.Fail()
+	}
+}
+
+func TestKeywordMatcher_Contains(t *testing.T) {
+	words := benchKeywords(2000)
+	m := NewKeywordMatcher(words)
+	for _, name := range []string{"www.kw1999x.com", "kw0.cn", "nothing.here", "kw.net", "a.kw12"} {
+		want := false
+		for _, w := range words {
+			if strings.Contains(name, w) {
+				want = true
+				break
+			}
+		}
+		if m.Contains(name) != want {
+			t.Errorf("Contains(%s) want %v", name, want)
+		}
+	}
+}
+
+func benchKeywords(n int) []string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("kw%d", i)
+	}
+	return words
+}
+
+func BenchmarkKeywordMatcher(b *testing.B) {
+	m := NewKeywordMatcher(benchKeywords(20000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		m.Contains("www.baidu.com.example.org")
+	}
+}
+
+func BenchmarkKeywordContains(b *testing.B) {
+	words := benchKeywords(20000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, w := range words {
+			if strings.Contains("www.baidu.com.example.org", w) {
+				break
+			}
+		}
+	}
+}
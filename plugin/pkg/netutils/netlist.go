@@ -1,100 +1,228 @@
 package netutils
 
 import (
-	"sort"
+	"net"
 	"sync"
 
 	"github.com/c-robinson/iplib"
-	"github.com/ca17/dnssrc/plugin/pkg/netutils"
 )
 
+// NetList 网络地址列表, IPv4 与 IPv6 分别存储在二进制前缀树中.
+// 聚合模式下插入时合并重叠与相邻的网段; 非聚合模式保留原始网段, 用于按网段绑定数据
 type NetList struct {
 	sync.RWMutex
-	data []iplib.Net
+	aggregate bool
+	root4     *netNode
+	root6     *netNode
+	count     int
 }
 
+type netNode struct {
+	children [2]*netNode
+	net      iplib.Net // 非空表示该节点为网段终点
+}
+
+// NewNetList 创建聚合模式的网络地址列表
 func NewNetList(data []iplib.Net) *NetList {
-	return &NetList{data: data, RWMutex: sync.RWMutex{}}
+	l := &NetList{RWMutex: sync.RWMutex{}, aggregate: true}
+	for _, inet := range data {
+		l.insert(inet)
+	}
+	return l
+}
+
+// NewBindingNetList 创建非聚合模式的网络地址列表, FindNet 返回原始网段
+func NewBindingNetList(data []iplib.Net) *NetList {
+	l := &NetList{RWMutex: sync.RWMutex{}}
+	for _, inet := range data {
+		l.insert(inet)
+	}
+	return l
 }
 
 func (l *NetList) Len() int {
 	l.RLock()
 	defer l.RUnlock()
-	return len(l.data)
+	return l.count
 }
 
 func (l *NetList) Add(inet iplib.Net) {
 	l.Lock()
 	defer l.Unlock()
-	l.data = append(l.data, inet)
+	l.insert(inet)
 }
 
 func (l *NetList) AddByString(nstr string) bool {
-	inet, err := netutils.ParseIpNet(nstr)
+	inet, err := ParseIpNet(nstr)
 	if err != nil {
 		return false
 	}
+	l.Add(inet)
+	return true
+}
+
+// Sort 前缀树有序存储, 保留以兼容原有调用
+func (l *NetList) Sort() {}
+
+// Clear 清空列表
+func (l *NetList) Clear() {
 	l.Lock()
 	defer l.Unlock()
-	l.data = append(l.data, inet)
-	return true
+	l.root4, l.root6, l.count = nil, nil, 0
 }
 
-func (l *NetList) Sort() {
+// Swap 使用 other 的数据替换当前列表, other 构建完成后不应再修改
+func (l *NetList) Swap(other *NetList) {
+	other.RLock()
+	root4, root6, count := other.root4, other.root6, other.count
+	other.RUnlock()
 	l.Lock()
 	defer l.Unlock()
-	sort.Slice(l.data, func(i, j int) bool {
-		return iplib.CompareNets(l.data[i], l.data[j]) < 1
-	})
+	l.root4, l.root6, l.count = root4, root6, count
 }
 
-func (l *NetList) MatchNet(lookingFor iplib.Net) bool {
-	l.RLock()
-	defer l.RUnlock()
-	var low int = 0
-	var high int = len(l.data) - 1
-	for low <= high {
-		var mid int = low + (high-low)/2
-		var midValue = l.data[mid]
-		if midValue.ContainsNet(lookingFor) {
-			return mid != -1
-		} else if iplib.CompareNets(midValue, lookingFor) > 0 {
-			high = mid - 1
-		} else {
-			low = mid + 1
+// netKey 返回网段的前缀树根节点, 地址字节与前缀长度
+func (l *NetList) netKey(inet iplib.Net) (**netNode, net.IP, int) {
+	ip, ones, v6 := prefixKey(inet)
+	if ip == nil {
+		return nil, nil, 0
+	}
+	if v6 {
+		return &l.root6, ip, ones
+	}
+	return &l.root4, ip, ones
+}
+
+// prefixKey 返回网段在前缀树中的地址字节与前缀长度, IPv4 映射的 IPv6 网段按 IPv4 处理
+func prefixKey(inet iplib.Net) (ip net.IP, ones int, v6 bool) {
+	if inet == nil || inet.IP() == nil {
+		return nil, 0, false
+	}
+	ones, bits := inet.Mask().Size()
+	ip = inet.IP()
+	if ip4 := ip.To4(); ip4 != nil {
+		if bits == 128 {
+			if ones < 96 {
+				return ip.To16(), ones, true
+			}
+			ones -= 96
+		}
+		return ip4, ones, false
+	}
+	return ip.To16(), ones, true
+}
+
+func ipBit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+func newPrefix(ip net.IP, ones int) iplib.Net {
+	if len(ip) == net.IPv4len {
+		return iplib.NewNet4(ip.Mask(net.CIDRMask(ones, 32)), ones)
+	}
+	return iplib.NewNet6(ip.Mask(net.CIDRMask(ones, 128)), ones, 0)
+}
+
+func (l *NetList) insert(inet iplib.Net) {
+	root, ip, ones := l.netKey(inet)
+	if root == nil {
+		return
+	}
+	if *root == nil {
+		*root = &netNode{}
+	}
+	l.insertNode(*root, ip, ones, 0)
+}
+
+// insertNode 递归插入网段, 聚合模式下回溯时合并兄弟网段
+func (l *NetList) insertNode(n *netNode, ip net.IP, ones int, depth int) {
+	if l.aggregate && n.net != nil {
+		return
+	}
+	if depth == ones {
+		if n.net == nil {
+			l.count++
+		}
+		n.net = newPrefix(ip, ones)
+		if l.aggregate {
+			l.count -= countNets(n.children[0]) + countNets(n.children[1])
+			n.children = [2]*netNode{}
 		}
+		return
+	}
+	b := ipBit(ip, depth)
+	if n.children[b] == nil {
+		n.children[b] = &netNode{}
+	}
+	l.insertNode(n.children[b], ip, ones, depth+1)
+	if !l.aggregate {
+		return
+	}
+	c0, c1 := n.children[0], n.children[1]
+	if c0 != nil && c1 != nil && c0.net != nil && c1.net != nil {
+		n.net = newPrefix(ip, depth)
+		n.children = [2]*netNode{}
+		l.count--
 	}
-	return false
 }
 
+func countNets(n *netNode) int {
+	if n == nil {
+		return 0
+	}
+	c := countNets(n.children[0]) + countNets(n.children[1])
+	if n.net != nil {
+		c++
+	}
+	return c
+}
+
+// FindNet 返回包含 lookingFor 的最具体网段, 未命中返回 nil
 func (l *NetList) FindNet(lookingFor iplib.Net) iplib.Net {
 	l.RLock()
 	defer l.RUnlock()
-	var low int = 0
-	var high int = len(l.data) - 1
-	for low <= high {
-		var mid int = low + (high-low)/2
-		var midValue = l.data[mid]
-		if midValue.ContainsNet(lookingFor) {
-			return midValue
-		} else if iplib.CompareNets(midValue, lookingFor) > 0 {
-			high = mid - 1
-		} else {
-			low = mid + 1
+	root, ip, ones := l.netKey(lookingFor)
+	if root == nil {
+		return nil
+	}
+	var found iplib.Net
+	n := *root
+	for depth := 0; n != nil; depth++ {
+		if n.net != nil {
+			found = n.net
+		}
+		if depth >= ones {
+			break
 		}
+		n = n.children[ipBit(ip, depth)]
 	}
-	return nil
+	return found
 }
 
+func (l *NetList) MatchNet(lookingFor iplib.Net) bool {
+	return l.FindNet(lookingFor) != nil
+}
+
+// ForEach 按地址顺序遍历网段, IPv4 在前
 func (l *NetList) ForEach(f func(net iplib.Net), max int) {
 	l.RLock()
 	defer l.RUnlock()
 	c := 0
-	for _, d := range l.data {
-		if max > 0 && c >= max {
-			return
+	var walk func(n *netNode) bool
+	walk = func(n *netNode) bool {
+		if n == nil {
+			return true
 		}
-		f(d)
-		c++
+		if n.net != nil {
+			if max > 0 && c >= max {
+				return false
+			}
+			f(n.net)
+			c++
+		}
+		return walk(n.children[0]) && walk(n.children[1])
+	}
+	if walk(l.root4) {
+		walk(l.root6)
 	}
 }
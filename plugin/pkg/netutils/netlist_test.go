@@ -52,8 +52,95 @@ func TestNetList_MatchNetat(t *testing.T) {
 func BenchmarkMatchNet(b *testing.B) {
 	ns := initData()
 	s, _ := ParseIpNet("10.0.200.2")
+	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
 		ns.MatchNet(s)
 	}
 }
 
+
+func netsOf(l *NetList) []string {
+	var items []string
+	l.ForEach(func(inet iplib.Net) {
+		items = append(items, inet.String())
+	}, 0)
+	return items
+}
+
+func TestNetList_Aggregate(t *testing.T) {
+	l := NewNetList(nil)
+	for _, s := range []string{"10.0.1.0/24", "10.0.0.0/24", "10.0.0.128/25", "192.168.0.0/16", "192.168.3.0/24", "2001:db8::/33", "2001:db8:8000::/33"} {
+		if !l.AddByString(s) {
+			t.Fatalf("add %s failed", s)
+		}
+	}
+	got := fmt.Sprint(netsOf(l))
+	if got != "[10.0.0.0/23 192.168.0.0/16 2001:db8::/32]" {
+		t.Errorf("nets = %s", got)
+	}
+	if l.Len() != 3 {
+		t.Errorf("Len = %d", l.Len())
+	}
+}
+
+func TestNetList_UnsortedMatch(t *testing.T) {
+	l := NewNetList(nil)
+	for _, s := range []string{"172.16.0.0/12", "1.1.1.0/24", "172.16.5.0/24", "8.8.8.8"} {
+		l.AddByString(s)
+	}
+	for ip, want := range map[string]bool{
+		"172.20.1.1": true, "172.16.5.9": true, "1.1.1.1": true, "8.8.8.8": true,
+		"8.8.4.4": false, "172.32.0.1": false,
+	} {
+		inet, _ := ParseIpNet(ip)
+		if l.MatchNet(inet) != want {
+			t.Errorf("MatchNet(%s) want %v", ip, want)
+		}
+	}
+}
+
+func TestNetList_BindingFindNet(t *testing.T) {
+	l := NewBindingNetList(nil)
+	for _, s := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24"} {
+		l.AddByString(s)
+	}
+	for ip, want := range map[string]string{
+		"10.1.2.3": "10.1.2.0/24", "10.1.3.3": "10.1.0.0/16", "10.2.0.1": "10.0.0.0/8",
+	} {
+		inet, _ := ParseIpNet(ip)
+		if n := l.FindNet(inet); n == nil || n.String() != want {
+			t.Errorf("FindNet(%s) = %v, want %s", ip, n, want)
+		}
+	}
+	inet, _ := ParseIpNet("11.0.0.1")
+	if l.FindNet(inet) != nil {
+		t.Fail()
+	}
+	if l.Len() != 3 {
+		t.Errorf("Len = %d", l.Len())
+	}
+}
+
+func TestNetList_IPv6(t *testing.T) {
+	l := NewNetList(nil)
+	for _, s := range []string{"2001:db8::/32", "2400:cb00::/32", "::ffff:192.0.2.0/120", "10.0.0.0/8"} {
+		l.AddByString(s)
+	}
+	for ip, want := range map[string]bool{
+		"2001:db8:1::1": true, "2400:cb00:2048::1": true, "2400:cb01::1": false,
+		"192.0.2.33": true, "::ffff:192.0.2.33": true, "::ffff:10.1.1.1": true,
+		"::a01:101": false, "fe80::1": false,
+	} {
+		inet, err := ParseIpNet(ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.MatchNet(inet) != want {
+			t.Errorf("MatchNet(%s) want %v", ip, want)
+		}
+	}
+	inet, _ := ParseIpNet("2001:db8::1")
+	if n := l.FindNet(inet); n == nil || n.String() != "2001:db8::/32" {
+		t.Errorf("FindNet = %v", n)
+	}
+}
@@ -2,25 +2,56 @@ package netutils
 
 import (
 	"fmt"
+	"net"
 	"strings"
 
 	iplib "github.com/c-robinson/iplib"
 )
 
 
+// ParseIpNet 解析 IP 或 CIDR, 单个地址按地址族使用 /32 或 /128, IPv4 映射的 IPv6 地址转换为 IPv4
 func ParseIpNet(d string) (inet iplib.Net, err error) {
 	if !strings.Contains(d, "/") {
-		d = d + "/32"
-	}
-	_net := iplib.Net4FromStr(d)
-	if _net.IP() == nil {
-		_net6 := iplib.Net6FromStr(d)
-		if _net6.IP() == nil {
+		ip := net.ParseIP(d)
+		if ip == nil {
 			return nil, fmt.Errorf("error ip  %s", d)
 		}
-		return _net6, nil
+		return HostNet(ip), nil
+	}
+	_, ipnet, err := net.ParseCIDR(d)
+	if err != nil {
+		return nil, fmt.Errorf("error ip  %s", d)
+	}
+	ones, _ := ipnet.Mask.Size()
+	return NewIPNet(ipnet.IP, ones), nil
+}
+
+// NormalizeIP IPv4 及 IPv4 映射的 IPv6 地址返回 4 字节形式, 其他返回 16 字节形式
+func NormalizeIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+// NewIPNet 按地址族创建网段, IPv4 映射的 IPv6 网段转换为 IPv4 网段
+func NewIPNet(ip net.IP, ones int) iplib.Net {
+	if ip4 := ip.To4(); ip4 != nil && (len(ip) == net.IPv4len || ones >= 96) {
+		if len(ip) == net.IPv6len {
+			ones -= 96
+		}
+		return iplib.NewNet4(ip4.Mask(net.CIDRMask(ones, 32)), ones)
+	}
+	ip = ip.To16()
+	return iplib.NewNet6(ip.Mask(net.CIDRMask(ones, 128)), ones, 0)
+}
+
+// HostNet 返回 IP 的主机网段, IPv4 为 /32, IPv6 为 /128
+func HostNet(ip net.IP) iplib.Net {
+	if ip4 := ip.To4(); ip4 != nil {
+		return NewIPNet(ip4, 32)
 	}
-	return _net, nil
+	return NewIPNet(ip, 128)
 }
 
 func ContainsNetAddr(ns []iplib.Net, ipstr string) bool {
@@ -18,3 +18,27 @@ func Test_CompareNets(t *testing.T) {
 	t.Log(iplib.CompareNets(p1, p2))
 	t.Log(p1.ContainsNet(p2))
 }
+
+func TestParseIpNet(t *testing.T) {
+	cases := map[string]string{
+		"192.168.0.1":         "192.168.0.1/32",
+		"192.168.0.1/24":      "192.168.0.0/24",
+		"2001:db8::1":         "2001:db8::1/128",
+		"2001:db8::1/64":      "2001:db8::/64",
+		"::ffff:10.0.0.1":     "10.0.0.1/32",
+		"::ffff:10.1.2.0/120": "10.1.2.0/24",
+		"::/0":                "::/0",
+	}
+	for s, want := range cases {
+		inet, err := ParseIpNet(s)
+		if err != nil {
+			t.Fatalf("ParseIpNet(%s): %v", s, err)
+		}
+		if inet.String() != want {
+			t.Errorf("ParseIpNet(%s) = %s, want %s", s, inet.String(), want)
+		}
+	}
+	if _, err := ParseIpNet("2001:db8::zz"); err == nil {
+		t.Fail()
+	}
+}
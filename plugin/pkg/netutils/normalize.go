@@ -0,0 +1,72 @@
+package netutils
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile 国际化域名转换, 按查询规则映射大小写与全角字符, 允许下划线等非主机名字符.
+// 使用 IDNA2008 非过渡处理, ß, ς 等字符保留原义, 与当前解析器和注册局一致
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.StrictDomainName(false),
+)
+
+// NormalizeDomain 规范化域名: 转为小写, 去掉末尾的点, 国际化域名转换为 punycode.
+// 数据表规则与匹配输入均使用该函数, 已规范化的域名直接返回, 不分配内存
+func NormalizeDomain(name string) string {
+	name = strings.TrimSuffix(name, ".")
+	upper := false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= utf8.RuneSelf {
+			if s, err := idnaProfile.ToASCII(name); err == nil {
+				return strings.TrimSuffix(s, ".")
+			}
+			return strings.ToLower(name)
+		}
+		if 'A' <= c && c <= 'Z' {
+			upper = true
+		}
+	}
+	if upper {
+		return lowerASCII(name)
+	}
+	return name
+}
+
+// normalizeKeyword 规范化关键词, 与 NormalizeDomain 使用相同的转换, 但保留首尾的点.
+// 国际化关键词转换为 punycode 后只能命中包含该标签编码的域名, 通常用于整个标签
+func normalizeKeyword(kw string) string {
+	for i := 0; i < len(kw); i++ {
+		if kw[i] >= utf8.RuneSelf {
+			if s, err := idnaProfile.ToASCII(kw); err == nil {
+				return s
+			}
+			return strings.ToLower(kw)
+		}
+	}
+	return lowerASCII(kw)
+}
+
+// NormalizeFqdn 规范化域名并添加末尾的点
+func NormalizeFqdn(name string) string {
+	name = NormalizeDomain(name)
+	if name == "" {
+		return "."
+	}
+	return name + "."
+}
+
+// lowerASCII 只转换 ASCII 字母的小写
+func lowerASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,52 @@
+package netutils
+
+import "testing"
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := map[string]string{
+		"example.com":        "example.com",
+		"Example.COM.":       "example.com",
+		"WWW.例子.测试":          "www.xn--fsqu00a.xn--0zwm56d",
+		"www.例子.测试.":         "www.xn--fsqu00a.xn--0zwm56d",
+		"Bücher.example":     "xn--bcher-kva.example",
+		"_dmarc.Example.com": "_dmarc.example.com",
+		"faß.de":             "xn--fa-hia.de",
+		"":                   "",
+		".":                  "",
+	}
+	for in, want := range tests {
+		if got := NormalizeDomain(in); got != want {
+			t.Errorf("NormalizeDomain(%q) = %q, want %q", in, got, want)
+		}
+	}
+	// 非过渡处理, 词尾 ς 不映射为 σ
+	if NormalizeDomain("σοφός.gr") == NormalizeDomain("σοφόσ.gr") {
+		t.Errorf("NormalizeDomain should keep final sigma")
+	}
+	if got := NormalizeFqdn("Example.COM"); got != "example.com." {
+		t.Errorf("NormalizeFqdn = %q", got)
+	}
+}
+
+func TestDomainList_Normalize(t *testing.T) {
+	l := NewDomainList()
+	l.Add(MatchDomainType, "Example.COM.")
+	l.Add(MatchFullType, "例子.测试")
+	l.Add(MatchKeywordType, "Tracker")
+	l.Add(MatchKeywordType, "BÜCHER")
+	l.Add(MatchKeywordType, "faß")
+	for _, name := range []string{"www.example.com", "WWW.EXAMPLE.COM.", "xn--fsqu00a.xn--0zwm56d", "例子.测试.", "AdTRACKER.net",
+		"www.Bücher.shop", "xn--bcher-kva.net", "FAß.de."} {
+		if !l.MixMatch(name) {
+			t.Errorf("MixMatch(%s) should match", name)
+		}
+	}
+	for _, name := range []string{"bucher.net", "fass.de"} {
+		if l.MixMatch(name) {
+			t.Errorf("MixMatch(%s) should not match", name)
+		}
+	}
+	if mtype, rule, ok := l.Lookup("Sub.Example.Com."); !ok || mtype != MatchDomainType || rule != "example.com" {
+		t.Errorf("Lookup = %s %s %v", mtype, rule, ok)
+	}
+}
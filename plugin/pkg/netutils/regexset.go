@@ -0,0 +1,188 @@
+package netutils
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"sync/atomic"
+)
+
+// RegexRule 正则规则及其命中计数
+type RegexRule struct {
+	re   *regexp.Regexp
+	hits uint64
+}
+
+func NewRegexRule(expr string) (*RegexRule, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &RegexRule{re: re}, nil
+}
+
+func (r *RegexRule) String() string {
+	return r.re.String()
+}
+
+// Hits 规则命中次数
+func (r *RegexRule) Hits() uint64 {
+	return atomic.LoadUint64(&r.hits)
+}
+
+// RegexSet 正则规则集合, 提取每条规则必须包含的字面量作为预过滤条件,
+// 只有名称包含该字面量时才执行对应的正则表达式
+type RegexSet struct {
+	rules     []*RegexRule
+	literals  *KeywordMatcher
+	byLiteral [][]int32 // 字面量下标对应的规则
+	always    []int32   // 无法提取字面量的规则
+}
+
+// NewRegexSet 构建规则集合, 规则对象与调用方共享, 命中计数在重建后保留
+func NewRegexSet(rules []*RegexRule) *RegexSet {
+	s := &RegexSet{rules: rules}
+	index := make(map[string]int)
+	var literals []string
+	for i, r := range rules {
+		lit := ""
+		if re, err := syntax.Parse(r.re.String(), syntax.Perl); err == nil {
+			lit = requiredLiteral(re.Simplify())
+		}
+		if lit == "" {
+			s.always = append(s.always, int32(i))
+			continue
+		}
+		li, ok := index[lit]
+		if !ok {
+			li = len(literals)
+			index[lit] = li
+			literals = append(literals, lit)
+			s.byLiteral = append(s.byLiteral, nil)
+		}
+		s.byLiteral[li] = append(s.byLiteral[li], int32(i))
+	}
+	s.literals = NewKeywordMatcher(literals)
+	return s
+}
+
+// requiredLiteral 返回所有匹配结果都必须包含的最长连续字面量, 无法确定时返回空
+func requiredLiteral(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return ""
+		}
+		return string(re.Rune)
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiteral(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return requiredLiteral(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		best := ""
+		for _, sub := range re.Sub {
+			if lit := requiredLiteral(sub); len(lit) > len(best) {
+				best = lit
+			}
+		}
+		return best
+	}
+	return ""
+}
+
+func (s *RegexSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.rules)
+}
+
+// Match 返回第一条匹配的规则, 并递增其命中计数
+func (s *RegexSet) Match(name string) (*RegexRule, bool) {
+	matched, ok := s.Find(name)
+	if ok {
+		atomic.AddUint64(&matched.hits, 1)
+	}
+	return matched, ok
+}
+
+// Find 返回第一条匹配的规则, 不计入命中次数
+func (s *RegexSet) Find(name string) (*RegexRule, bool) {
+	if s == nil || len(s.rules) == 0 {
+		return nil, false
+	}
+	var matched *RegexRule
+	for _, i := range s.always {
+		if r := s.rules[i]; r.re.MatchString(name) {
+			matched = r
+			break
+		}
+	}
+	if matched == nil {
+		var seen [8]int
+		n := 0
+		s.literals.MatchEach(name, func(li int) bool {
+			for j := 0; j < n && j < len(seen); j++ {
+				if seen[j] == li {
+					return true
+				}
+			}
+			if n < len(seen) {
+				seen[n] = li
+			}
+			n++
+			for _, i := range s.byLiteral[li] {
+				if r := s.rules[i]; r.re.MatchString(name) {
+					matched = r
+					return false
+				}
+			}
+			return true
+		})
+	}
+	if matched == nil {
+		return nil, false
+	}
+	return matched, true
+}
+
+// MatchEach 遍历匹配 name 的全部规则下标, 不计入命中次数, f 返回 false 时停止
+func (s *RegexSet) MatchEach(name string, f func(i int) bool) {
+	if s == nil || len(s.rules) == 0 {
+		return
+	}
+	for _, i := range s.always {
+		if s.rules[i].re.MatchString(name) && !f(int(i)) {
+			return
+		}
+	}
+	var seen map[int]bool
+	s.literals.MatchEach(name, func(li int) bool {
+		if seen[li] {
+			return true
+		}
+		if seen == nil {
+			seen = make(map[int]bool)
+		}
+		seen[li] = true
+		for _, i := range s.byLiteral[li] {
+			if s.rules[i].re.MatchString(name) && !f(int(i)) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// ForEach 遍历规则
+func (s *RegexSet) ForEach(f func(r *RegexRule) bool) {
+	if s == nil {
+		return
+	}
+	for _, r := range s.rules {
+		if !f(r) {
+			return
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package netutils
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"testing"
+)
+
+func TestRequiredLiteral(t *testing.T) {
+	cases := []struct {
+		expr string
+		lit  string
+	}{
+		{`^adservice\.google\.([a-z]{2}|com?)(\.[a-z]{2})?$`, "adservice.google."},
+		{`(^|\.)doubleclick\.net$`, "doubleclick.net"},
+		{`(ads|track)\.example\.com`, ".example.com"},
+		{`(?i)ads\.com`, ""},
+		{`^[a-z]+$`, ""},
+		{`(abc)+x`, "abc"},
+		{`a|b`, ""},
+	}
+	for _, c := range cases {
+		re, err := syntax.Parse(c.expr, syntax.Perl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lit := requiredLiteral(re.Simplify()); lit != c.lit {
+			t.Errorf("requiredLiteral(%s) = %q, want %q", c.expr, lit, c.lit)
+		}
+	}
+}
+
+func TestRegexSet_Match(t *testing.T) {
+	exprs := []string{
+		`^adservice\.google\.([a-z]{2}|com?)(\.[a-z]{2})?$`,
+		`(^|\.)doubleclick\.net$`,
+		`^[0-9]+\.cdn\.`,
+		`(?i)^TRACK\.`,
+	}
+	var rules []*RegexRule
+	for _, e := range exprs {
+		r, err := NewRegexRule(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, r)
+	}
+	set := NewRegexSet(rules)
+	names := []string{
+		"adservice.google.com", "adservice.google.com.hk", "www.google.com",
+		"stats.doubleclick.net", "doubleclick.net.cn", "123.cdn.example.com",
+		"a1.cdn.example.com", "track.example.com", "Track.example.com", "",
+	}
+	for _, name := range names {
+		want := false
+		for _, e := range exprs {
+			if regexp.MustCompile(e).MatchString(name) {
+				want = true
+				break
+			}
+		}
+		if _, ok := set.Match(name); ok != want {
+			t.Errorf("Match(%s) = %v, want %v", name, ok, want)
+		}
+	}
+	if rules[0].Hits() != 2 || rules[1].Hits() != 1 || rules[3].Hits() != 2 {
+		t.Errorf("hits %d %d %d", rules[0].Hits(), rules[1].Hits(), rules[3].Hits())
+	}
+}
+
+func TestDomainList_RegexHits(t *testing.T) {
+	d := NewDomainList()
+	d.Add(MatchRegexType, `\.ads\.`)
+	d.MatchRegex("x.ads.com")
+	d.Add(MatchRegexType, `^track\.`)
+	d.MatchRegex("x.ads.com")
+	d.MatchRegex("track.com")
+	hits := map[string]uint64{}
+	d.RegexHits(func(expr string, n uint64) {
+		hits[expr] = n
+	})
+	if hits[`\.ads\.`] != 2 || hits[`^track\.`] != 1 {
+		t.Errorf("RegexHits = %v", hits)
+	}
+	if mtype, rule, ok := d.Lookup("track.com"); !ok || mtype != MatchRegexType || rule != `^track\.` {
+		t.Errorf("Lookup = %s %s %v", mtype, rule, ok)
+	}
+	d.RegexHits(func(expr string, n uint64) {
+		if n != hits[expr] {
+			t.Errorf("Lookup should not count hits, %s = %d", expr, n)
+		}
+	})
+}
+
+func benchRegexs(n int) []string {
+	exprs := make([]string, n)
+	for i := range exprs {
+		exprs[i] = fmt.Sprintf(`(^|\.)ad%d\.example[0-9]*\.com$`, i)
+	}
+	return exprs
+}
+
+func BenchmarkRegexSetMatch(b *testing.B) {
+	d := NewDomainList()
+	d.InitDomainData(MatchRegexType, benchRegexs(2000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		d.MatchRegex("adservice.google.com")
+	}
+}
+
+func BenchmarkRegexListMatch(b *testing.B) {
+	var res []*regexp.Regexp
+	for _, e := range benchRegexs(2000) {
+		res = append(res, regexp.MustCompile(e))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, re := range res {
+			if re.MatchString("adservice.google.com") {
+				break
+			}
+		}
+	}
+}
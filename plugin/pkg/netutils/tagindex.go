@@ -0,0 +1,251 @@
+package netutils
+
+import (
+	"math/bits"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/c-robinson/iplib"
+)
+
+// TagSet 标签位图, 第 i 位表示索引中的第 i 个标签
+type TagSet []uint64
+
+func (s TagSet) Has(i int) bool {
+	return i/64 < len(s) && s[i/64]&(1<<uint(i%64)) != 0
+}
+
+func (s *TagSet) Add(i int) {
+	for len(*s) <= i/64 {
+		*s = append(*s, 0)
+	}
+	(*s)[i/64] |= 1 << uint(i%64)
+}
+
+// Or 并入 o 中的标签
+func (s *TagSet) Or(o TagSet) {
+	for len(*s) < len(o) {
+		*s = append(*s, 0)
+	}
+	for i, w := range o {
+		(*s)[i] |= w
+	}
+}
+
+// AndNot 移除 o 中的标签
+func (s TagSet) AndNot(o TagSet) {
+	for i := 0; i < len(s) && i < len(o); i++ {
+		s[i] &^= o[i]
+	}
+}
+
+func (s TagSet) Empty() bool {
+	for _, w := range s {
+		if w != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ForEach 按位序遍历标签
+func (s TagSet) ForEach(f func(i int)) {
+	for wi, w := range s {
+		for w != 0 {
+			b := bits.TrailingZeros64(w)
+			f(wi*64 + b)
+			w &^= 1 << uint(b)
+		}
+	}
+}
+
+// DomainTagIndex 多标签域名索引, 所有标签的完整匹配与后缀匹配规则合并到一棵域名树,
+// 关键词与正则规则分别合并为一个匹配器, 一次遍历得到域名命中的全部标签.
+// 规则添加完成后调用 Build, 之后只读使用
+type DomainTagIndex struct {
+	root        tagTrieNode
+	keywordTags map[string]TagSet
+	regexTable  []*RegexRule
+	regexTags   []TagSet
+	keywords    *KeywordMatcher
+	regexSet    *RegexSet
+}
+
+type tagTrieNode struct {
+	label    string
+	full     TagSet
+	domain   TagSet
+	children []*tagTrieNode // 按 label 排序
+}
+
+func NewDomainTagIndex() *DomainTagIndex {
+	return &DomainTagIndex{keywordTags: make(map[string]TagSet)}
+}
+
+func (n *tagTrieNode) child(label string) *tagTrieNode {
+	i := sort.Search(len(n.children), func(i int) bool { return n.children[i].label >= label })
+	if i < len(n.children) && n.children[i].label == label {
+		return n.children[i]
+	}
+	return nil
+}
+
+func (n *tagTrieNode) addChild(label string) *tagTrieNode {
+	i := sort.Search(len(n.children), func(i int) bool { return n.children[i].label >= label })
+	if i < len(n.children) && n.children[i].label == label {
+		return n.children[i]
+	}
+	c := &tagTrieNode{label: label}
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = c
+	return c
+}
+
+// Add 添加标签 tag 的规则, matchType 为 full, domain, keyword 或 regex
+func (x *DomainTagIndex) Add(tag int, matchType string, name string) bool {
+	switch matchType {
+	case MatchFullType, MatchDomainType:
+		name = NormalizeDomain(name)
+		if name == "" {
+			return false
+		}
+		n := &x.root
+		for end := len(name); end >= 0; {
+			label, i := lastLabel(name, end)
+			n = n.addChild(label)
+			end = i
+		}
+		if matchType == MatchFullType {
+			n.full.Add(tag)
+		} else {
+			n.domain.Add(tag)
+		}
+	case MatchKeywordType:
+		if name == "" {
+			return false
+		}
+		name = strings.ToLower(name)
+		tags := x.keywordTags[name]
+		tags.Add(tag)
+		x.keywordTags[name] = tags
+	case MatchRegexType:
+		r, err := NewRegexRule(name)
+		if err != nil {
+			return false
+		}
+		var tags TagSet
+		tags.Add(tag)
+		x.regexTable = append(x.regexTable, r)
+		x.regexTags = append(x.regexTags, tags)
+	default:
+		return false
+	}
+	return true
+}
+
+// Build 编译关键词与正则匹配器
+func (x *DomainTagIndex) Build() {
+	words := make([]string, 0, len(x.keywordTags))
+	for word := range x.keywordTags {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	x.keywords = NewKeywordMatcher(words)
+	x.regexSet = NewRegexSet(x.regexTable)
+}
+
+// Match 返回域名命中的全部标签
+func (x *DomainTagIndex) Match(name string) TagSet {
+	name = NormalizeDomain(name)
+	var tags TagSet
+	if name == "" {
+		return tags
+	}
+	n := &x.root
+	for end := len(name); end >= 0; {
+		label, i := lastLabel(name, end)
+		if n = n.child(label); n == nil {
+			break
+		}
+		tags.Or(n.domain)
+		if i < 0 {
+			tags.Or(n.full)
+		}
+		end = i
+	}
+	if x.keywords != nil {
+		words := x.keywords.Keywords()
+		x.keywords.MatchEach(name, func(i int) bool {
+			tags.Or(x.keywordTags[words[i]])
+			return true
+		})
+	}
+	x.regexSet.MatchEach(name, func(i int) bool {
+		tags.Or(x.regexTags[i])
+		return true
+	})
+	return tags
+}
+
+// NetTagIndex 多标签网络地址索引, 所有标签的网段合并到 IPv4 与 IPv6 前缀树中,
+// 一次遍历得到地址命中的全部标签. 构建完成后只读使用
+type NetTagIndex struct {
+	root4 *netTagNode
+	root6 *netTagNode
+}
+
+type netTagNode struct {
+	children [2]*netTagNode
+	tags     TagSet
+}
+
+func NewNetTagIndex() *NetTagIndex {
+	return &NetTagIndex{}
+}
+
+func (x *NetTagIndex) root(inet iplib.Net, create bool) (*netTagNode, net.IP, int) {
+	ip, ones, v6 := prefixKey(inet)
+	if ip == nil {
+		return nil, nil, 0
+	}
+	r := &x.root4
+	if v6 {
+		r = &x.root6
+	}
+	if *r == nil && create {
+		*r = &netTagNode{}
+	}
+	return *r, ip, ones
+}
+
+// Add 添加标签 tag 的网段
+func (x *NetTagIndex) Add(tag int, inet iplib.Net) {
+	n, ip, ones := x.root(inet, true)
+	if n == nil {
+		return
+	}
+	for depth := 0; depth < ones; depth++ {
+		b := ipBit(ip, depth)
+		if n.children[b] == nil {
+			n.children[b] = &netTagNode{}
+		}
+		n = n.children[b]
+	}
+	n.tags.Add(tag)
+}
+
+// Match 返回包含 inet 的全部网段的标签
+func (x *NetTagIndex) Match(inet iplib.Net) TagSet {
+	var tags TagSet
+	n, ip, ones := x.root(inet, false)
+	for depth := 0; n != nil; depth++ {
+		tags.Or(n.tags)
+		if depth >= ones {
+			break
+		}
+		n = n.children[ipBit(ip, depth)]
+	}
+	return tags
+}
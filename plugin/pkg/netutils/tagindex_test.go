@@ -0,0 +1,73 @@
+package netutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func tagSetBits(s TagSet) []int {
+	var r []int
+	s.ForEach(func(i int) { r = append(r, i) })
+	return r
+}
+
+func TestDomainTagIndex_Match(t *testing.T) {
+	x := NewDomainTagIndex()
+	x.Add(0, MatchDomainType, "example.com")
+	x.Add(1, MatchFullType, "www.example.com")
+	x.Add(2, MatchKeywordType, "Track")
+	x.Add(70, MatchRegexType, `^img[0-9]+\.`)
+	x.Add(70, MatchDomainType, "cdn.net")
+	if x.Add(3, MatchRegexType, `(`) {
+		t.Error("invalid regex should be rejected")
+	}
+	x.Build()
+
+	cases := []struct {
+		name string
+		bits []int
+	}{
+		{"example.com", []int{0}},
+		{"WWW.Example.com.", []int{0, 1}},
+		{"a.www.example.com", []int{0}},
+		{"track.example.com", []int{0, 2}},
+		{"img1.cdn.net", []int{70}},
+		{"tracker.org", []int{2}},
+		{"other.org", nil},
+	}
+	for _, c := range cases {
+		if bits := tagSetBits(x.Match(c.name)); !reflect.DeepEqual(bits, c.bits) {
+			t.Errorf("Match(%s) = %v, want %v", c.name, bits, c.bits)
+		}
+	}
+}
+
+func TestNetTagIndex_Match(t *testing.T) {
+	x := NewNetTagIndex()
+	for tag, cidr := range []string{"10.0.0.0/8", "10.1.0.0/16", "2001:db8::/32", "0.0.0.0/0"} {
+		inet, err := ParseIpNet(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x.Add(tag, inet)
+	}
+	cases := []struct {
+		ip   string
+		bits []int
+	}{
+		{"10.1.2.3", []int{0, 1, 3}},
+		{"10.2.0.0/16", []int{0, 3}},
+		{"192.168.1.1", []int{3}},
+		{"2001:db8::1", []int{2}},
+		{"2001:db9::1", nil},
+	}
+	for _, c := range cases {
+		inet, err := ParseIpNet(c.ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bits := tagSetBits(x.Match(inet)); !reflect.DeepEqual(bits, c.bits) {
+			t.Errorf("Match(%s) = %v, want %v", c.ip, bits, c.bits)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+// Package tagexpr 标签布尔表达式, 如 `cn & !ads`, `(google | apple) & !private`.
+//
+// 运算符优先级从高到低为 `!`, `&`, `|`; `,` 与 `|` 等价, 兼容原有的标签列表写法.
+// 标签由字母, 数字及 `-_.@:/` 组成, 标签中间的 `!` 作为标签的一部分, 如 `geolocation-!cn`, `google@!ads`.
+package tagexpr
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	opTag = iota
+	opNot
+	opAnd
+	opOr
+)
+
+// Expr 编译后的标签表达式, 只读, 可并发使用
+type Expr struct {
+	op   int
+	tag  string
+	subs []*Expr
+	text string // 根节点缓存的规范化文本
+}
+
+// Parse 编译标签表达式, 标签统一转为大写
+func Parse(s string) (*Expr, error) {
+	p := &parser{src: s}
+	p.next()
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != tokEOF {
+		return nil, fmt.Errorf("tag expression %q: unexpected %q at %d", s, p.lit, p.pos)
+	}
+	return e.seal(), nil
+}
+
+// MustParse 编译标签表达式, 出错时 panic
+func MustParse(s string) *Expr {
+	e, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// FromTags 由标签列表构造 `tag | tag ...` 表达式
+func FromTags(tags []string) *Expr {
+	e := &Expr{op: opOr}
+	for _, tag := range tags {
+		e.subs = append(e.subs, &Expr{op: opTag, tag: strings.ToUpper(tag)})
+	}
+	if len(e.subs) == 1 {
+		return e.subs[0].seal()
+	}
+	return e.seal()
+}
+
+// Not 返回表达式的取反
+func Not(e *Expr) *Expr {
+	return (&Expr{op: opNot, subs: []*Expr{e}}).seal()
+}
+
+// seal 缓存规范化文本, 表达式构造完成后不再修改
+func (e *Expr) seal() *Expr {
+	e.text = ""
+	e.text = e.String()
+	return e
+}
+
+// IsExpr 判断字符串是否使用了 `,` 以外的表达式运算符
+func IsExpr(s string) bool {
+	if strings.ContainsAny(s, "&|()") {
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '!' && (i == 0 || !isTagChar(s[i-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// Eval 按短路规则求值, match 返回单个标签的匹配结果
+func (e *Expr) Eval(match func(tag string) bool) bool {
+	switch e.op {
+	case opTag:
+		return match(e.tag)
+	case opNot:
+		return !e.subs[0].Eval(match)
+	case opAnd:
+		for _, sub := range e.subs {
+			if !sub.Eval(match) {
+				return false
+			}
+		}
+		return true
+	case opOr:
+		for _, sub := range e.subs {
+			if sub.Eval(match) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// Tags 返回表达式引用的标签, 按出现顺序去重
+func (e *Expr) Tags() []string {
+	var tags []string
+	seen := make(map[string]bool)
+	var walk func(e *Expr)
+	walk = func(e *Expr) {
+		if e.op == opTag {
+			if !seen[e.tag] {
+				seen[e.tag] = true
+				tags = append(tags, e.tag)
+			}
+			return
+		}
+		for _, sub := range e.subs {
+			walk(sub)
+		}
+	}
+	walk(e)
+	return tags
+}
+
+// Map 返回标签经 f 转换后的新表达式, 用于分组标签解析
+func (e *Expr) Map(f func(tag string) string) *Expr {
+	return e.mapTags(f).seal()
+}
+
+func (e *Expr) mapTags(f func(tag string) string) *Expr {
+	if e.op == opTag {
+		return &Expr{op: opTag, tag: f(e.tag)}
+	}
+	r := &Expr{op: e.op, subs: make([]*Expr, len(e.subs))}
+	for i, sub := range e.subs {
+		r.subs[i] = sub.mapTags(f)
+	}
+	return r
+}
+
+// String 返回规范化的表达式文本, 可用作缓存键
+func (e *Expr) String() string {
+	if e.text != "" {
+		return e.text
+	}
+	switch e.op {
+	case opTag:
+		return e.tag
+	case opNot:
+		return "!" + e.subs[0].wrap(opNot)
+	}
+	sep := " & "
+	if e.op == opOr {
+		sep = " | "
+	}
+	items := make([]string, len(e.subs))
+	for i, sub := range e.subs {
+		items[i] = sub.wrap(e.op)
+	}
+	return strings.Join(items, sep)
+}
+
+// wrap 子表达式优先级低于父表达式时加括号
+func (e *Expr) wrap(parent int) string {
+	if e.op > parent {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+const (
+	tokEOF = iota
+	tokTag
+	tokNot
+	tokAnd
+	tokOr
+	tokLParen
+	tokRParen
+	tokIllegal
+)
+
+type parser struct {
+	src string
+	off int
+	pos int
+	tok int
+	lit string
+}
+
+func isTagChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.IndexByte("-_.@:/", c) >= 0
+}
+
+func (p *parser) next() {
+	for p.off < len(p.src) && (p.src[p.off] == ' ' || p.src[p.off] == '\t') {
+		p.off++
+	}
+	p.pos = p.off
+	if p.off >= len(p.src) {
+		p.tok, p.lit = tokEOF, ""
+		return
+	}
+	c := p.src[p.off]
+	p.off++
+	p.lit = string(c)
+	switch c {
+	case '!':
+		p.tok = tokNot
+	case '&':
+		p.tok = tokAnd
+	case '|', ',':
+		p.tok = tokOr
+	case '(':
+		p.tok = tokLParen
+	case ')':
+		p.tok = tokRParen
+	default:
+		if !isTagChar(c) {
+			p.tok = tokIllegal
+			return
+		}
+		for p.off < len(p.src) {
+			c := p.src[p.off]
+			if !isTagChar(c) && c != '!' {
+				break
+			}
+			p.off++
+		}
+		p.tok, p.lit = tokTag, p.src[p.pos:p.off]
+	}
+}
+
+func (p *parser) errorf(want string) error {
+	if p.tok == tokEOF {
+		return fmt.Errorf("tag expression %q: expect %s at end", p.src, want)
+	}
+	return fmt.Errorf("tag expression %q: expect %s, got %q at %d", p.src, want, p.lit, p.pos)
+}
+
+func (p *parser) parseOr() (*Expr, error) {
+	return p.parseBinary(opOr, tokOr, p.parseAnd)
+}
+
+func (p *parser) parseAnd() (*Expr, error) {
+	return p.parseBinary(opAnd, tokAnd, p.parseUnary)
+}
+
+func (p *parser) parseBinary(op int, tok int, operand func() (*Expr, error)) (*Expr, error) {
+	e, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != tok {
+		return e, nil
+	}
+	r := &Expr{op: op, subs: []*Expr{e}}
+	for p.tok == tok {
+		p.next()
+		e, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		r.subs = append(r.subs, e)
+	}
+	return r, nil
+}
+
+func (p *parser) parseUnary() (*Expr, error) {
+	switch p.tok {
+	case tokNot:
+		p.next()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(e), nil
+	case tokLParen:
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != tokRParen {
+			return nil, p.errorf("')'")
+		}
+		p.next()
+		return e, nil
+	case tokTag:
+		e := &Expr{op: opTag, tag: strings.ToUpper(p.lit)}
+		p.next()
+		return e, nil
+	}
+	return nil, p.errorf("tag")
+}
@@ -0,0 +1,98 @@
+package tagexpr
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"cn", "CN"},
+		{"cn,google", "CN | GOOGLE"},
+		{"cn & !ads", "CN & !ADS"},
+		{"(google | apple) & !private", "(GOOGLE | APPLE) & !PRIVATE"},
+		{"a | b & c", "A | B & C"},
+		{"!(a|b)", "!(A | B)"},
+		{"!!a", "!!A"},
+		{"geolocation-cn@!cn & office/ads", "GEOLOCATION-CN@!CN & OFFICE/ADS"},
+	}
+	for _, tc := range tests {
+		e, err := Parse(tc.src)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", tc.src, err)
+		}
+		if e.String() != tc.want {
+			t.Errorf("Parse(%s) = %s, want %s", tc.src, e.String(), tc.want)
+		}
+		// 规范化文本可再次解析为相同表达式
+		if e2 := MustParse(e.String()); e2.String() != e.String() {
+			t.Errorf("reparse %s = %s", e.String(), e2.String())
+		}
+	}
+	for _, src := range []string{"", "cn &", "(cn", "cn)", "& cn", "cn # ads", "cn ads"} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("Parse(%q) expect error", src)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	set := map[string]bool{"CN": true, "GOOGLE": true}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"cn", true},
+		{"ads", false},
+		{"cn & !ads", true},
+		{"cn & !google", false},
+		{"(google | apple) & !private", true},
+		{"!(cn, ads)", false},
+		{"ads | apple | !private", true},
+	}
+	for _, tc := range tests {
+		var calls []string
+		got := MustParse(tc.src).Eval(func(tag string) bool {
+			calls = append(calls, tag)
+			return set[tag]
+		})
+		if got != tc.want {
+			t.Errorf("Eval(%s) = %v, want %v", tc.src, got, tc.want)
+		}
+	}
+	// 短路求值
+	calls := 0
+	MustParse("ads & cn & google").Eval(func(tag string) bool {
+		calls++
+		return set[tag]
+	})
+	if calls != 1 {
+		t.Errorf("short circuit calls = %d", calls)
+	}
+}
+
+func TestTagsAndMap(t *testing.T) {
+	e := MustParse("(cn | ads) & !cn")
+	if tags := e.Tags(); len(tags) != 2 || tags[0] != "CN" || tags[1] != "ADS" {
+		t.Errorf("Tags = %v", tags)
+	}
+	m := e.Map(func(tag string) string { return "G/" + tag })
+	if m.String() != "(G/CN | G/ADS) & !G/CN" || e.String() != "(CN | ADS) & !CN" {
+		t.Errorf("Map = %s", m.String())
+	}
+	if FromTags([]string{"a", "b"}).String() != "A | B" || FromTags([]string{"a"}).String() != "A" {
+		t.Fail()
+	}
+}
+
+func TestIsExpr(t *testing.T) {
+	for s, want := range map[string]bool{
+		"cn,google": false, "geolocation-cn@!cn": false, "geolocation-!cn": false, "cn&ads": true, "!cn": true, "(cn)": true,
+	} {
+		if IsExpr(s) != want {
+			t.Errorf("IsExpr(%s) want %v", s, want)
+		}
+	}
+}